@@ -0,0 +1,238 @@
+package dictionary
+
+import (
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AnagramIndex finds the headwords in a Store which are anagrams of a set of
+// letters using an index of their signatures (their letters in sorted order).
+// Only letters are considered (spaces, dashes, and other characters are
+// ignored), and they are normalized in the same way as for a Completer, so
+// "dormitory" matches "dirty room". It is safe for concurrent use.
+type AnagramIndex struct {
+	store Store
+
+	mu   sync.RWMutex
+	sigs map[string][]string // sorted headwords for each signature
+}
+
+// NewAnagramIndex builds an AnagramIndex for the headwords in a Store, which
+// must implement Iterator.
+func NewAnagramIndex(store Store) (*AnagramIndex, error) {
+	a := &AnagramIndex{store: store}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload rebuilds the index from the Store (e.g. after an Overlay changes).
+func (a *AnagramIndex) Reload() error {
+	it, err := Headwords(a.store, "", "")
+	if err != nil {
+		return err
+	}
+
+	sigs := map[string][]string{}
+	for it.Next() {
+		hw := it.Headword()
+		if sig := anagramSig(hw); sig != "" {
+			sigs[sig] = append(sigs[sig], hw) // already sorted
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.sigs = sigs
+	a.mu.Unlock()
+	return nil
+}
+
+// Anagrams returns up to n headwords which use exactly the same letters, in
+// sorted order. If subset is true, headwords which only use some of the
+// letters (each one at most as many times as it was given) are also returned,
+// longest first. If n is zero or less, all of them are returned.
+func (a *AnagramIndex) Anagrams(letters string, subset bool, n int) []string {
+	sig := anagramSig(letters)
+	if sig == "" {
+		return []string{}
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if !subset {
+		hws := a.sigs[sig]
+		if n > 0 && len(hws) > n {
+			hws = hws[:n]
+		}
+		return append([]string{}, hws...)
+	}
+
+	// look up each combination of the letters if there are fewer of them
+	// than signatures, otherwise check every signature
+	var ss []string
+	if rs, cs := anagramCounts(sig); anagramCombinations(cs, len(a.sigs)) <= len(a.sigs) {
+		anagramEach(rs, cs, func(s string) {
+			if _, ok := a.sigs[s]; ok {
+				ss = append(ss, s)
+			}
+		})
+	} else {
+		for s := range a.sigs {
+			if isAnagramSubset(s, rs, cs) {
+				ss = append(ss, s)
+			}
+		}
+	}
+
+	var res []string
+	for _, s := range ss {
+		res = append(res, a.sigs[s]...)
+	}
+	return anagrams(res, n)
+}
+
+// Anagrams returns headwords in a Store which are anagrams of letters, as
+// described for AnagramIndex. Every headword is checked, so an AnagramIndex
+// should be used if anagrams are needed more than once. The store must
+// implement Iterator.
+func Anagrams(store Store, letters string, subset bool, n int) ([]string, error) {
+	sig := anagramSig(letters)
+	if sig == "" {
+		return []string{}, nil
+	}
+
+	it, err := Headwords(store, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	rs, cs := anagramCounts(sig)
+
+	var res []string
+	for it.Next() {
+		hw := it.Headword()
+		if s := anagramSig(hw); s == sig || (subset && s != "" && isAnagramSubset(s, rs, cs)) {
+			res = append(res, hw)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return anagrams(res, n), nil
+}
+
+// anagrams sorts anagrams by the number of letters (descending), then by
+// headword, and returns up to n of them.
+func anagrams(hws []string, n int) []string {
+	ls := make(map[string]int, len(hws))
+	for _, hw := range hws {
+		ls[hw] = utf8.RuneCountInString(anagramSig(hw))
+	}
+	sort.Slice(hws, func(i, j int) bool {
+		if li, lj := ls[hws[i]], ls[hws[j]]; li != lj {
+			return li > lj
+		}
+		return hws[i] < hws[j]
+	})
+	if n > 0 && len(hws) > n {
+		hws = hws[:n]
+	}
+	if hws == nil {
+		hws = []string{}
+	}
+	return hws
+}
+
+// anagramSig returns the normalized letters of s in sorted order.
+func anagramSig(s string) string {
+	var rs []rune
+	for _, r := range completeKey(s) {
+		if unicode.IsLetter(r) {
+			rs = append(rs, r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i] < rs[j]
+	})
+	return string(rs)
+}
+
+// anagramCounts returns the distinct letters in a signature and the number of
+// times each occurs.
+func anagramCounts(sig string) ([]rune, []int) {
+	var rs []rune
+	var cs []int
+	for _, r := range sig {
+		if len(rs) != 0 && rs[len(rs)-1] == r {
+			cs[len(cs)-1]++
+		} else {
+			rs, cs = append(rs, r), append(cs, 1)
+		}
+	}
+	return rs, cs
+}
+
+// anagramCombinations returns the number of distinct non-empty subsets of
+// letters with the counts cs, or a number greater than max if there are more.
+func anagramCombinations(cs []int, max int) int {
+	n := 1
+	for _, c := range cs {
+		if n *= c + 1; n > max+1 {
+			return max + 1
+		}
+	}
+	return n - 1
+}
+
+// anagramEach calls fn with the signature of every distinct non-empty subset
+// of letters with the counts cs.
+func anagramEach(rs []rune, cs []int, fn func(sig string)) {
+	buf := make([]rune, 0, len(rs))
+	var rec func(i int)
+	rec = func(i int) {
+		if i == len(rs) {
+			if len(buf) != 0 {
+				fn(string(buf))
+			}
+			return
+		}
+		n := len(buf)
+		for c := 0; c <= cs[i]; c++ {
+			if c != 0 {
+				buf = append(buf, rs[i])
+			}
+			rec(i + 1)
+		}
+		buf = buf[:n]
+	}
+	rec(0)
+}
+
+// isAnagramSubset checks if every letter in the signature occurs at most as
+// many times as in the letters and counts from anagramCounts. It does not
+// allocate, since it is called for every signature in an AnagramIndex.
+func isAnagramSubset(sig string, rs []rune, cs []int) bool {
+	var i, n int // the current letter, and the number of times it was used
+	for _, r := range sig {
+		if i < len(rs) && rs[i] == r {
+			if n++; n > cs[i] {
+				return false
+			}
+			continue
+		}
+		for i++; i < len(rs) && rs[i] < r; i++ {
+		}
+		if i >= len(rs) || rs[i] != r {
+			return false
+		}
+		n = 1
+	}
+	return true
+}
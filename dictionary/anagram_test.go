@@ -0,0 +1,55 @@
+package dictionary
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsAnagramSubset(t *testing.T) {
+	for _, c := range []struct {
+		sig, letters string
+		exp          bool
+	}{
+		{"", "", true},
+		{"", "abc", true},
+		{"a", "", false},
+		{"abc", "abc", true},
+		{"ac", "abc", true},
+		{"aab", "abc", false},
+		{"aab", "aabc", true},
+		{"aaab", "aabc", false},
+		{"abd", "abc", false},
+		{"z", "abc", false},
+		{"éé", "eéé", true},
+	} {
+		rs, cs := anagramCounts(c.letters)
+		if act := isAnagramSubset(c.sig, rs, cs); act != c.exp {
+			t.Errorf("%q in %q: expected %t, got %t", c.sig, c.letters, c.exp, act)
+		}
+	}
+}
+
+func TestAnagramIndex(t *testing.T) {
+	wm := WordMap{}
+	for _, hw := range []string{"act", "cat", "tac", "at", "a", "tact", "dog"} {
+		wm[hw] = []*Word{{Word: hw}}
+	}
+	a, err := NewAnagramIndex(wm)
+	if err != nil {
+		t.Fatalf("new anagram index: %v", err)
+	}
+	for _, c := range []struct {
+		letters string
+		subset  bool
+		exp     []string
+	}{
+		{"TCA", false, []string{"act", "cat", "tac"}},
+		{"tca", true, []string{"act", "cat", "tac", "at", "a"}},
+		{"ttca", true, []string{"tact", "act", "cat", "tac", "at", "a"}},
+		{"xyz", true, nil},
+	} {
+		if act := a.Anagrams(c.letters, c.subset, 0); (len(act) != 0 || len(c.exp) != 0) && !reflect.DeepEqual(act, c.exp) {
+			t.Errorf("%q (subset %t): expected %q, got %q", c.letters, c.subset, c.exp, act)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package dictionary
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats contains statistics about a File's word cache.
+type CacheStats struct {
+	Hits   uint64 // lookups served from the cache
+	Misses uint64 // lookups which needed to read the record
+	Len    int    // number of words currently cached
+	Size   int    // maximum number of words to cache
+}
+
+// wordCache is a concurrency-safe LRU cache of decoded words by record offset.
+// A cache with a size of zero is disabled.
+type wordCache struct {
+	mu     sync.Mutex
+	size   int
+	ll     *list.List // of *wordCacheEntry, most recently used first
+	items  map[size]*list.Element
+	hits   uint64
+	misses uint64
+}
+
+type wordCacheEntry struct {
+	cur size
+	w   *Word
+}
+
+func newWordCache() *wordCache {
+	return &wordCache{
+		ll:    list.New(),
+		items: map[size]*list.Element{},
+	}
+}
+
+// Resize sets the maximum number of cached words, evicting the least recently
+// used ones if necessary.
+func (c *wordCache) Resize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = n
+	c.evict()
+}
+
+// Get gets a cached word. If the cache is enabled, a hit or miss is counted. The
+// returned word must not be modified.
+func (c *wordCache) Get(cur size) (*Word, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size == 0 {
+		return nil, false
+	}
+	if e, ok := c.items[cur]; ok {
+		c.hits++
+		c.ll.MoveToFront(e)
+		return e.Value.(*wordCacheEntry).w, true
+	}
+	c.misses++
+	return nil, false
+}
+
+// Add adds a word to the cache if it is enabled. The word must not be modified
+// afterwards.
+func (c *wordCache) Add(cur size, w *Word) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size == 0 {
+		return
+	}
+	if e, ok := c.items[cur]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*wordCacheEntry).w = w
+		return
+	}
+	c.items[cur] = c.ll.PushFront(&wordCacheEntry{cur, w})
+	c.evict()
+}
+
+// Enabled checks whether the cache is enabled.
+func (c *wordCache) Enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size != 0
+}
+
+// Stats returns the current cache statistics.
+func (c *wordCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:   c.hits,
+		Misses: c.misses,
+		Len:    c.ll.Len(),
+		Size:   c.size,
+	}
+}
+
+func (c *wordCache) evict() {
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*wordCacheEntry).cur)
+	}
+}
@@ -0,0 +1,118 @@
+package dictionary
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Completer completes prefixes of headwords in a Store. The headwords are
+// normalized the same way as LookupWord (case, whitespace, punctuation, dashes,
+// and diacritics, but not stemming), and kept in a sorted in-memory index, so
+// completion only needs a binary search. It is safe for concurrent use.
+type Completer struct {
+	store Store
+
+	mu   sync.RWMutex
+	keys []string // normalized, sorted
+	hws  []string // the headwords for keys
+}
+
+// NewCompleter builds a Completer for the headwords in a Store, which must
+// implement Iterator.
+func NewCompleter(store Store) (*Completer, error) {
+	c := &Completer{store: store}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload rebuilds the index from the Store (e.g. after an Overlay changes).
+func (c *Completer) Reload() error {
+	it, err := Headwords(c.store, "", "")
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		key, hw string
+	}
+	var es []entry
+	for it.Next() {
+		hw := it.Headword()
+		es = append(es, entry{completeKey(hw), hw})
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].key != es[j].key {
+			return es[i].key < es[j].key
+		}
+		return es[i].hw < es[j].hw
+	})
+
+	keys, hws := make([]string, len(es)), make([]string, len(es))
+	for i, e := range es {
+		keys[i], hws[i] = e.key, e.hw
+	}
+
+	c.mu.Lock()
+	c.keys, c.hws = keys, hws
+	c.mu.Unlock()
+	return nil
+}
+
+// Complete returns up to n headwords which start with prefix after
+// normalization, in sorted order. If n is zero or less, all of them are
+// returned. If the normalized prefix is empty, nothing is returned.
+func (c *Completer) Complete(prefix string, n int) []string {
+	key := completeKey(prefix)
+	if key == "" {
+		return []string{}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res := []string{}
+	for i := sort.SearchStrings(c.keys, key); i < len(c.keys) && strings.HasPrefix(c.keys[i], key); i++ {
+		if n > 0 && len(res) == n {
+			break
+		}
+		res = append(res, c.hws[i])
+	}
+	return res
+}
+
+// completeKey normalizes a headword or prefix for a Completer.
+func completeKey(s string) string {
+	if isCompleteKey(s) {
+		return s // fast path for most headwords
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = normSpaceRe.ReplaceAllLiteralString(s, " ")
+	s = normOpenCloseRe.ReplaceAllLiteralString(s, "")
+	s = normDashRe.ReplaceAllLiteralString(s, "-")
+	s = normADashRe.ReplaceAllLiteralString(s, "-")
+	if f, err := normFold(s); err == nil {
+		s = f
+	}
+	return s
+}
+
+// isCompleteKey checks if s only contains lowercase ASCII letters and digits
+// separated by single spaces or dashes, so it would not be changed by
+// completeKey.
+func isCompleteKey(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case (c == ' ' || c == '-') && i != 0 && i != len(s)-1 && s[i-1] != ' ' && s[i-1] != '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
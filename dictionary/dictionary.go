@@ -3,12 +3,9 @@
 package dictionary
 
 import (
-	"fmt"
 	"regexp"
-	"strings"
 	"unicode"
 
-	"github.com/kljensen/snowball"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 )
@@ -38,6 +35,10 @@ type Word struct {
 	Word            string        `json:"word,omitempty" diskstore:"w"`
 	Alternates      []string      `json:"alternates,omitempty" diskstore:"a"`
 	Info            string        `json:"info,omitempty" diskstore:"i"`
+	PartsOfSpeech   []string      `json:"pos,omitempty" diskstore:"p,omitempty"`         // parsed from the info (e.g. "noun", "transitive verb")
+	Syllables       []string      `json:"syllables,omitempty" diskstore:"y,omitempty"`   // parsed from the info (joined, they form the headword)
+	Stress          []int         `json:"stress,omitempty" diskstore:"s,omitempty"`      // parsed from the info (the Stress* level of each syllable)
+	Inflections     []Inflection  `json:"inflections,omitempty" diskstore:"f,omitempty"` // parsed from the info
 	Etymology       string        `json:"etymology,omitempty" diskstore:"e"`
 	Meanings        []WordMeaning `json:"meanings,omitempty" diskstore:"m"`
 	Notes           []string      `json:"notes,omitempty" diskstore:"n"`
@@ -52,6 +53,41 @@ type WordMeaning struct {
 	ReferencedWords []string `json:"referenced_words" diskstore:"r"`
 }
 
+// clone returns a deep copy of the word.
+func (w *Word) clone() *Word {
+	c := *w
+	c.Alternates = cloneStrings(w.Alternates)
+	c.Notes = cloneStrings(w.Notes)
+	c.ReferencedWords = cloneStrings(w.ReferencedWords)
+	c.PartsOfSpeech = cloneStrings(w.PartsOfSpeech)
+	c.Syllables = cloneStrings(w.Syllables)
+	if w.Stress != nil {
+		c.Stress = append(make([]int, 0, len(w.Stress)), w.Stress...)
+	}
+	if w.Inflections != nil {
+		c.Inflections = make([]Inflection, len(w.Inflections))
+		for i, f := range w.Inflections {
+			f.Tags = cloneStrings(f.Tags)
+			c.Inflections[i] = f
+		}
+	}
+	if w.Meanings != nil {
+		c.Meanings = make([]WordMeaning, len(w.Meanings))
+		for i, m := range w.Meanings {
+			m.ReferencedWords = cloneStrings(m.ReferencedWords)
+			c.Meanings[i] = m
+		}
+	}
+	return &c
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
+
 // Lookup looks up the first entry for a word in the dictionary (deprecated). It
 // applies normalization and stemming to the word if no direct match is found.
 func Lookup(store Store, word string) (*Word, bool, error) {
@@ -67,90 +103,44 @@ var (
 	normDashRe      = regexp.MustCompile(`\p{Pd}`)
 	normADashRe     = regexp.MustCompile(`-+`)
 	normOpenCloseRe = regexp.MustCompile(`^(?:\p{Pi}|\p{Ps}|["'])+|(?:\p{Pf}|\p{Pe}|["'])+$`)
-	normTransform   = transform.Chain(norm.NFD, transform.RemoveFunc(func(r rune) bool {
-		return unicode.Is(unicode.Mn, r)
-	}), norm.NFC)
 )
 
+// normFold folds all unicode chars into their bases. A new transformer is used
+// each time since they are not safe for concurrent use.
+func normFold(s string) (string, error) {
+	s, _, err := transform.String(transform.Chain(norm.NFD, transform.RemoveFunc(func(r rune) bool {
+		return unicode.Is(unicode.Mn, r)
+	}), norm.NFC), s)
+	return s, err
+}
+
 // LookupWord looks up a word in the dictionary. It applies normalization and
 // stemming to the word if no direct match is found.
 func LookupWord(store Store, word string) ([]*Word, bool, error) {
-	var err error
-
-	ws := word
-
-	for a := 0; a < 2; a++ {
-		// trim leading and trailing spaces
-		if ws = strings.ToLower(strings.TrimSpace(word)); store.HasWord(ws) {
-			goto found
-		}
-
-		// collapse all whitespace into a single space
-		if ws = normSpaceRe.ReplaceAllLiteralString(ws, " "); store.HasWord(ws) {
-			goto found
-		}
-
-		// trim leading and trailing opening/closing punctuation
-		if ws = normOpenCloseRe.ReplaceAllLiteralString(ws, ""); store.HasWord(ws) {
-			goto found
-		}
-
-		// replace all unicode dash-like characters with a dash
-		if ws = normDashRe.ReplaceAllLiteralString(ws, "-"); store.HasWord(ws) {
-			goto found
-		}
-
-		// collapse multiple dashes
-		if ws = normADashRe.ReplaceAllLiteralString(ws, "-"); store.HasWord(ws) {
-			goto found
-		}
-
-		for b := 0; b < 2; b++ {
-			// stem
-			if wst, err := snowball.Stem(ws, "english", true); err == nil && store.HasWord(wst) {
-				ws = wst
-				goto found
-			}
-
-			// sometimes stemming removes too much
-			if wst := strings.TrimRight(ws, "s"); store.HasWord(wst) {
-				ws = wst
-				goto found
-			}
-
-			// sometimes stemming removes too much
-			if wst := strings.TrimSuffix(strings.TrimSuffix(ws, "ly"), "ing"); store.HasWord(ws) {
-				ws = wst
-				goto found
-			}
-
-			// try again, but fold all unicode chars into their bases
-			if b == 0 {
-				if ws, _, err = transform.String(normTransform, ws); err != nil {
-					break
-				} else if store.HasWord(ws) {
-					goto found
-				}
-			}
-		}
+	ws, _, exists, err := LookupWordResult(store, word)
+	return ws, exists, err
+}
 
-		// try again, but remove dashes
-		if a == 0 {
-			if ws = strings.Replace(ws, "-", "", -1); store.HasWord(ws) {
-				goto found
-			}
-		}
-	}
+// LookupResult describes how a word was found by LookupWord.
+type LookupResult struct {
+	Input string   `json:"input"`           // the word which was looked up
+	Key   string   `json:"key"`             // the headword which matched
+	Steps []string `json:"steps"`           // the steps which changed the word, in order
+	Lemma *Lemma   `json:"lemma,omitempty"` // if it was found as an inflected form
 
-	return nil, false, nil
+	// Candidates are the other headwords which matched, in order, if
+	// LookupOptions.AllCandidates was set.
+	Candidates []*LookupResult `json:"candidates,omitempty"`
+}
 
-found:
-	w, exists, err := store.GetWords(ws)
-	if err != nil {
-		return nil, true, fmt.Errorf("error getting word '%s': %v", ws, err)
-	} else if !exists {
-		panic("word should exist if HasWord")
-	}
+// LookupWordResult is like LookupWord, but it also returns how the word was
+// found. It uses DefaultPipeline.
+func LookupWordResult(store Store, word string) ([]*Word, *LookupResult, bool, error) {
+	return DefaultPipeline.Lookup(store, word)
+}
 
-	return w, true, nil
+// LookupWordOptions is like LookupWordResult, but it only normalizes the word
+// as allowed by the options (see Pipeline.LookupOptions).
+func LookupWordOptions(store Store, word string, o LookupOptions) ([]*Word, *LookupResult, bool, error) {
+	return DefaultPipeline.LookupOptions(store, word, o)
 }
@@ -5,59 +5,77 @@ import (
 	"compress/zlib"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"runtime/debug"
+	"sort"
+	"strings"
 
 	"github.com/vmihailenco/msgpack/v5"
 )
 
 // FileVer is the current compatibility level of saved Files.
-const FileVer = "DICT6\x00" // note: can currently handle "DICT5\x00" too
+const FileVer = "DICT8\x00" // note: can currently handle "DICT5\x00", "DICT6\x00" and "DICT7\x00" too
 
 // File implements an efficient Store which is faster to initialize and uses a lot less memory (~15 MB total) than WordMap.
 //
-// There needs to be enough memory to store the whole index. Reading a dict is also completely thread-safe. Corrupt files
+// The index is a sorted key table which is searched directly from the file bytes (see keyTable), so only the raw index
+// needs to fit in memory (and with OpenFileMmap, not even that). Reading a dict is also completely thread-safe. Corrupt files
 // will be detected during the read of the corrupted word (or the initialization in the case of index corruption)
 // or during Verify.
 //
 // The dict file is stored in the following format:
 //
-//   + --------- + ------------ + --------------------------------------------- + ---------- + ------------------------------------------------- +
-//   |           |              |  + ---- + ---------------------------- +      |            |                                                   |
-//   |  FileVer  |  idx offset  |  | size | zlib compressed Word msgpack | ...  |  idx size  |  zlib compressed idx map[string][]offset msgpack  |
-//   |           |              |  + =================================== +      |            |                                                   |
-//   + --------- + ------------ + --------------------------------------------- + ============================================================== +
+//   + --------- + ---------- + --------------------------------------------- + ----------------------------------------------------------- + ----- +
+//   |           |            |  + ----- + -------- + ------ + ---------- +    |  + ---- + ------------------------------------------------- +  |       |
+//   |  FileVer  |  nsection  |  |  tag  |  offset  |  size  |  sha256    | ..|  | size | crc32c | zlib compressed Word msgpack           | ..|  idx  |
+//   |           |            |  + ================================== +    |  + ================================================== +  |       |
+//   + --------- + ---------- + --------------------------------------------- + ============================================================= + ===== +
 //
-//   All sizes and offsets are little-endian int64. All sizes are the size of the size plus the data.
+//   All sizes and offsets are little-endian int64, and the crc32c (Castagnoli) is a little-endian uint32 of the
+//   compressed data. All record sizes are the size of the size plus the data. Each section is identified by a 4-byte
+//   tag, and the sha256 is of the entire section. Unused section slots have a zero tag. The data section (DATA)
+//   contains the records, and the idx section (INDX) contains a key table of headwords to []offset. The optional
+//   sections are the metadata (META), the text index used for Search (TEXT, see textIndex), and a key table of the
+//   inflected forms listed in Word.Inflections to []offset (INFL).
 //
 // The file is opened using the following steps:
 //
 // 1. The FileVer is read and checked. It must match exactly.
-// 2. The idx offset is read.
-// 3. The file is seeked to the beginning plus the idx offset.
-// 4. The idx size is read.
-// 5. The bytes for the idx are decompressed using zlib, and the resulting msgpack is decoded into an in-memory map[string][]int64 of the words to offsets.
+// 2. The section table is read.
+// 3. The bytes for the idx section are read into memory (or mapped with OpenFileMmap or sliced with OpenBytes) as-is.
+// 4. The digests of the idx and the other optional sections are checked.
 //
 // To read a word:
 //
-// 1. The offset is retrieved from the in-memory idx.
+// 1. The offsets are retrieved by searching the idx.
 // 2. The file is seeked to the beginning plus the offset.
-// 4. The size of the compressed word is read.
-// 5. The bytes for the word are decompressed using zlib, and the resulting msgpack is decoded into an in-memory *Word.
+// 4. The size and checksum of the compressed word is read.
+// 5. The bytes for the word are checked against the checksum.
+// 6. The bytes for the word are decompressed using zlib, and the resulting msgpack is decoded into an in-memory *Word.
 //
-// For more details, see the source code.
+// The digest of the data section is only checked by Verify.
+//
+// For more details, see the source code. DICT5, DICT6, and DICT7 files have an idx offset instead of the section
+// table, no checksums, and the idx at the end of the file prefixed by its size. DICT5 and DICT6 files store the idx
+// as a zlib compressed map[string]offset or map[string][]offset msgpack, which is decoded into memory.
 //
 // It is up to the creator to ensure there aren't duplicate references to
 // entries for headwords in the index. If duplicates are found, they will be
 // returned as-is.
 type File struct {
-	idx map[string][]size
-	df  interface {
-		io.Reader
-		io.Closer
-		io.ReaderAt
-	}
+	ver      int
+	sections []section
+	dataOff  int64 // start of the records
+	dataEnd  int64 // end of the records
+	meta     *Metadata
+	text     *textIndex // if present
+	infl     index      // if present
+	idx      index
+	cache    *wordCache
+	df       io.ReaderAt
+	close    func() error // may be nil
 }
 
 type size int64
@@ -77,214 +95,221 @@ func (s *size) Read(r io.Reader) error {
 }
 
 // CreateFile exports a WordMap to a file. The files specified will
-// be overwritten if they exist.
+// be overwritten if they exist. It is a wrapper around Writer.AddWordMap,
+// so the order of the entries for each headword is preserved, and the output
+// is deterministic (the same WordMap will always produce a byte-identical
+// file).
 func CreateFile(wm WordMap, dictfile string) error {
-	f, err := os.Create(dictfile)
+	dw, err := CreateWriter(dictfile)
 	if err != nil {
-		return fmt.Errorf("could not create db: %v", err)
-	}
-	defer f.Sync()
-	defer f.Close()
-
-	// data
-
-	var verendoff int64
-	if _, err := f.Write(make([]byte, len(FileVer))); err != nil {
-		return fmt.Errorf("could not write version placeholder: %v", err)
-	} else if verendoff, err = f.Seek(0, io.SeekCurrent); err != nil {
-		return fmt.Errorf("could not get version end offset: %v", err)
-	} else if verendoff-int64(len(FileVer)) != 0 {
-		panic("bug: incorrect verendoff")
-	}
-
-	var idxoffendoff int64
-	if err := size(0).Write(f); err != nil {
-		return fmt.Errorf("could not write idx offset placeholder: %v", err)
-	} else if idxoffendoff, err = f.Seek(0, io.SeekCurrent); err != nil {
-		return fmt.Errorf("could not get idx offset end offset: %v", err)
-	} else if idxoffendoff-sizew != verendoff {
-		panic("bug: incorrect idxoffendoff")
+		return err
 	}
+	defer dw.Close()
 
-	var dataendoff int64
-	idx := map[string][]size{}
-	if err := func() error {
-		var wordendoff int64 = idxoffendoff
-		var t int64 // for testing
-		rev := map[*Word]size{}
-		for k, ws := range wm {
-			for _, w := range ws {
-				if wordoff, ok := rev[w]; ok {
-					idx[k] = append(idx[k], wordoff)
-					continue
-				}
-				rev[w] = size(wordendoff)
-				idx[k] = append(idx[k], rev[w])
-
-				x, err := f.Seek(0, io.SeekCurrent) // for testing
-				if err != nil {
-					return fmt.Errorf("could not word start offset: %v", err)
-				}
-
-				if err = size(0).Write(f); err != nil {
-					return fmt.Errorf("could not get word size placeholder: %v", err)
-				} else if zw, err := zlib.NewWriterLevel(f, zlib.BestCompression); err != nil {
-					return fmt.Errorf("could not compress word: %v", err)
-				} else if err = func() error {
-					e := msgpack.NewEncoder(zw)
-					e.SetCustomStructTag("diskstore")
-					return e.Encode(w)
-				}(); err != nil {
-					return fmt.Errorf("could not encode word: %v", err)
-				} else if err = zw.Close(); err != nil {
-					return fmt.Errorf("could not compress word: %v", err)
-				} else if wordendoff, err = f.Seek(0, io.SeekCurrent); err != nil {
-					return fmt.Errorf("could not get word end offset: %v", err)
-				}
-
-				t += wordendoff - x // for testing
-
-				if _, err := f.Seek(int64(rev[w]), io.SeekStart); err != nil {
-					return fmt.Errorf("could not seek to word size placeholder: %v", err)
-				} else if err := size(wordendoff - int64(rev[w])).Write(f); err != nil {
-					return fmt.Errorf("could not write word size: %v", err)
-				} else if wordendoff-t != idxoffendoff {
-					panic("bug: incorrect wordendoff")
-				}
-
-				if _, err := f.Seek(wordendoff, io.SeekStart); err != nil {
-					return fmt.Errorf("could not seek to end of current word: %v", err)
-				}
-			}
-		}
-		dataendoff = idxoffendoff + t
-		return nil
-	}(); err != nil {
+	if err := dw.AddWordMap(wm); err != nil {
 		return fmt.Errorf("could not write data: %v", err)
-	} else if x, err := f.Seek(0, io.SeekCurrent); err != nil {
-		return fmt.Errorf("could not get data end offset: %v", err)
-	} else if dataendoff != x {
-		panic("bug: incorrect dataendoff")
-	}
-
-	var idxendoff int64
-	if err := size(0).Write(f); err != nil {
-		return fmt.Errorf("could not write idx size placeholder: %v", err)
-	} else if zw, err := zlib.NewWriterLevel(f, zlib.BestCompression); err != nil {
-		return fmt.Errorf("could not compress idx: %v", err)
-	} else if err = func() error {
-		e := msgpack.NewEncoder(zw)
-		e.SetCustomStructTag("diskstore")
-		e.SetSortMapKeys(false)
-		e.UseCompactInts(true)
-		return e.Encode(idx)
-	}(); err != nil {
-		return fmt.Errorf("could not encode idx: %v", err)
-	} else if err = zw.Close(); err != nil {
-		return fmt.Errorf("could not compress idx: %v", err)
-	} else if idxendoff, err = f.Seek(0, io.SeekCurrent); err != nil {
-		return fmt.Errorf("could not get idx end offset: %v", err)
-	} else if idxendoff-dataendoff <= sizew {
-		panic("bug: incorrect idxendoff")
 	}
 
-	// offsets/sizes/version
-
-	if _, err := f.Seek(int64(verendoff), io.SeekStart); err != nil {
-		return fmt.Errorf("could not seek to idx offset placeholder: %v", err)
-	} else if err = size(dataendoff).Write(f); err != nil {
-		return fmt.Errorf("could not write idx offset: %v", err)
-	}
+	return dw.Close()
+}
 
-	_ = dataendoff - idxoffendoff // word offsets in the data section were written earlier
+// Open opens a dictionary from r, which is sz bytes long. It will return errors
+// if there are errors reading r or critical errors in the structure. If the file
+// is malformed, a *FormatError is returned. The File does not take ownership of
+// r, and Close will not close it.
+func Open(r io.ReaderAt, sz int64) (*File, error) {
+	return openFile(r, sz)
+}
 
-	if _, err := f.Seek(dataendoff, io.SeekStart); err != nil {
-		return fmt.Errorf("could not seek to idx size placeholder: %v", err)
-	} else if err = size(idxendoff - dataendoff).Write(f); err != nil {
-		return fmt.Errorf("could not write idx size: %v", err)
-	}
+// OpenBytes is like Open, but it reads the dictionary from a byte slice (e.g. an
+// embedded file) without copying the index or the records. The slice must not be
+// modified while the File is in use.
+func OpenBytes(b []byte) (*File, error) {
+	return openFile(byteFile(b), int64(len(b)))
+}
 
-	if _, err := f.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf("could not seek to version placeholder: %v", err)
-	} else if _, err = f.WriteString(FileVer); err != nil {
-		return fmt.Errorf("could not write version: %v", err)
+// OpenFile opens a dictionary file. It will return errors if
+// there are errors reading the files or critical errors in the structure.
+// If the file is malformed, a *FormatError is returned.
+func OpenFile(dictfile string) (*File, error) {
+	f, err := os.OpenFile(dictfile, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open db: %w", err)
 	}
 
-	// cleanup
-
-	if err := f.Sync(); err != nil {
-		return fmt.Errorf("could not write file: %v", err)
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not stat db: %w", err)
 	}
 
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("could not write file: %v", err)
+	d, err := openFile(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
 	}
-
-	return nil
+	d.close = f.Close
+	return d, nil
 }
 
-// OpenFile opens a dictionary file. It will return errors if
-// there are errors reading the files or critical errors in the structure.
-func OpenFile(dictfile string) (*File, error) {
+// openFile reads the header and index from df, which is sz bytes long. Every
+// offset and size is checked against sz and the other parts of the file.
+func openFile(df io.ReaderAt, sz int64) (*File, error) {
 	var d File
 	var err error
 
-	d.df, err = os.OpenFile(dictfile, os.O_RDONLY, 0)
-	if err != nil {
-		return nil, fmt.Errorf("could not open db: %v", err)
-	}
+	d.df = df
+	d.cache = newWordCache()
+	hr := io.NewSectionReader(df, 0, sz) // for reading the header sequentially
 
 	var compat int
 	buf := make([]byte, len(FileVer))
-	_, err = d.df.Read(buf)
-	if err != nil {
-		return nil, fmt.Errorf("could not read version string: %v", err)
+	if sz < int64(len(buf)) {
+		return nil, formatErr("version", 0, ErrOutOfBounds, fmt.Errorf("file is only %d bytes", sz))
+	} else if _, err = io.ReadFull(hr, buf); err != nil {
+		return nil, fmt.Errorf("could not read version string: %w", err)
 	} else if bytes.Equal(buf, []byte(FileVer)) {
+		compat = 8
+	} else if bytes.Equal(buf, []byte("DICT7\x00")) {
+		compat = 7
+	} else if bytes.Equal(buf, []byte("DICT6\x00")) {
 		compat = 6
 	} else if bytes.Equal(buf, []byte("DICT5\x00")) {
 		compat = 5
 	} else if bytes.Equal(buf, []byte("\x00\x00\x00\x00\x00\x00")) {
-		return nil, fmt.Errorf("incomplete file version: did it create successfully?")
+		return nil, formatErr("version", 0, ErrIncomplete, nil)
 	} else {
-		return nil, fmt.Errorf("incompatible file versions: expected %#v, got %#v", FileVer, string(buf))
+		return nil, formatErr("version", 0, ErrVersion, fmt.Errorf("expected %#v, got %#v", FileVer, string(buf)))
+	}
+	d.ver = compat
+
+	if compat >= 8 {
+		if d.sections, err = readSections(hr, sz); err != nil {
+			return nil, err
+		}
+		sec, ok := d.section(sectionData)
+		if !ok {
+			return nil, formatErr("section table", int64(len(FileVer)), ErrMalformed, fmt.Errorf("missing %s section", sectionData))
+		}
+		d.dataOff, d.dataEnd = sec.Offset, sec.Offset+sec.Size
+
+		if sec, ok = d.section(sectionIdx); !ok {
+			return nil, formatErr("section table", int64(len(FileVer)), ErrMalformed, fmt.Errorf("missing %s section", sectionIdx))
+		}
+		b, err := d.bytes(sec.Offset, sec.Size)
+		if err != nil {
+			return nil, fmt.Errorf("could not read idx: %w", err)
+		} else if err := sec.verifyBytes(b); err != nil {
+			return nil, formatErr("idx", sec.Offset, ErrChecksum, err)
+		}
+		t, err := parseKeyTable(b)
+		if err != nil {
+			return nil, formatErr("idx", sec.Offset, ErrMalformed, err)
+		}
+		d.idx = tableIndex{t, sec.Offset}
+
+		if sec, ok := d.section(sectionMeta); ok {
+			if sec.Size > maxMetaSize {
+				return nil, formatErr("metadata", sec.Offset, ErrTooLarge, fmt.Errorf("section is %d bytes", sec.Size))
+			} else if b, err := d.bytes(sec.Offset, sec.Size); err != nil {
+				return nil, fmt.Errorf("could not read metadata: %w", err)
+			} else if err := sec.verifyBytes(b); err != nil {
+				return nil, formatErr("metadata", sec.Offset, ErrChecksum, err)
+			} else if d.meta, err = decodeMetadata(b); err != nil {
+				return nil, formatErr("metadata", sec.Offset, ErrMalformed, err)
+			}
+		}
+
+		if sec, ok := d.section(sectionInfl); ok {
+			if b, err := d.bytes(sec.Offset, sec.Size); err != nil {
+				return nil, fmt.Errorf("could not read inflection index: %w", err)
+			} else if err := sec.verifyBytes(b); err != nil {
+				return nil, formatErr("inflection index", sec.Offset, ErrChecksum, err)
+			} else if t, err := parseKeyTable(b); err != nil {
+				return nil, formatErr("inflection index", sec.Offset, ErrMalformed, err)
+			} else {
+				d.infl = tableIndex{t, sec.Offset}
+			}
+		}
+
+		if sec, ok := d.section(sectionText); ok {
+			if b, err := d.bytes(sec.Offset, sec.Size); err != nil {
+				return nil, fmt.Errorf("could not read text index: %w", err)
+			} else if err := sec.verifyBytes(b); err != nil {
+				return nil, formatErr("text index", sec.Offset, ErrChecksum, err)
+			} else if d.text, err = parseTextIndex(b); err != nil {
+				return nil, formatErr("text index", sec.Offset, ErrMalformed, err)
+			}
+		}
+		return &d, nil
 	}
 
 	var idxoff, idxsize size
-	if err := (&idxoff).Read(d.df); err != nil {
-		return nil, fmt.Errorf("could not read idx offset: %v", err)
+	if sz < int64(len(FileVer))+sizew {
+		return nil, formatErr("idx offset", int64(len(FileVer)), ErrOutOfBounds, fmt.Errorf("file is only %d bytes", sz))
+	} else if err := (&idxoff).Read(hr); err != nil {
+		return nil, fmt.Errorf("could not read idx offset: %w", err)
+	}
+	d.dataOff, d.dataEnd = int64(len(FileVer))+sizew, int64(idxoff)
+
+	if int64(idxoff) < d.dataOff || int64(idxoff) > sz-sizew {
+		return nil, formatErr("idx offset", int64(len(FileVer)), ErrOutOfBounds, fmt.Errorf("offset %d not within %d-%d", idxoff, d.dataOff, sz-sizew))
+	} else if err := (&idxsize).Read(io.NewSectionReader(d.df, int64(idxoff), sizew)); err != nil {
+		return nil, fmt.Errorf("could not read idx size: %w", err)
+	} else if idxsize < size(sizew) || int64(idxsize) > sz-int64(idxoff) {
+		return nil, formatErr("idx", int64(idxoff), ErrOutOfBounds, fmt.Errorf("size %d not within %d-%d", idxsize, sizew, sz-int64(idxoff)))
 	}
 
-	if err := (&idxsize).Read(io.NewSectionReader(d.df, int64(idxoff), sizew)); err != nil {
-		return nil, fmt.Errorf("could not read idx size: %v", err)
+	if compat >= 7 {
+		b, err := d.bytes(int64(idxoff)+sizew, int64(idxsize)-sizew)
+		if err != nil {
+			return nil, fmt.Errorf("could not read idx: %w", err)
+		}
+		t, err := parseKeyTable(b)
+		if err != nil {
+			return nil, formatErr("idx", int64(idxoff), ErrMalformed, err)
+		}
+		d.idx = tableIndex{t, int64(idxoff)}
+		return &d, nil
 	}
 
 	zr, err := zlib.NewReader(io.NewSectionReader(d.df, int64(idxoff)+sizew, int64(idxsize)-sizew))
 	if err != nil {
-		return nil, fmt.Errorf("could not decompress idx: %v", err)
+		return nil, formatErr("idx", int64(idxoff), ErrMalformed, err)
 	}
 	defer zr.Close()
 
+	lr := &limitReader{r: zr, n: maxIdxSize}
 	if compat >= 6 {
+		var idx map[string][]size
 		if err := func() error {
-			c := msgpack.NewDecoder(zr)
+			c := msgpack.NewDecoder(lr)
 			c.SetCustomStructTag("diskstore")
-			return c.Decode(&d.idx)
+			return c.Decode(&idx)
 		}(); err != nil {
-			return nil, fmt.Errorf("could not read idx: %v", err)
+			if lr.exceeded {
+				return nil, formatErr("idx", int64(idxoff), ErrTooLarge, nil)
+			}
+			return nil, formatErr("idx", int64(idxoff), ErrMalformed, err)
 		}
+		d.idx = newMapIndex(idx)
 	} else {
 		var oidx map[string]size
 		if err := func() error {
-			c := msgpack.NewDecoder(zr)
+			c := msgpack.NewDecoder(lr)
 			c.SetCustomStructTag("diskstore")
 			return c.Decode(&oidx)
 		}(); err != nil {
-			return nil, fmt.Errorf("could not read idx: %v", err)
+			if lr.exceeded {
+				return nil, formatErr("idx", int64(idxoff), ErrTooLarge, nil)
+			}
+			return nil, formatErr("idx", int64(idxoff), ErrMalformed, err)
 		}
-		d.idx = make(map[string][]size, len(oidx))
+		idx := make(map[string][]size, len(oidx))
 		for w, o := range oidx {
-			d.idx[w] = []size{o}
+			idx[w] = []size{o}
 		}
+		d.idx = newMapIndex(idx)
 	}
 
 	debug.FreeOSMemory()
@@ -292,52 +317,84 @@ func OpenFile(dictfile string) (*File, error) {
 	return &d, nil
 }
 
-// Verify verifies the consistency of the data structures in the dict file.
-// WARNING: Verify takes a few seconds to run.
-func (d *File) Verify() error {
-	for word, cur := range d.idx {
-		for _, o := range cur {
-			if w, err := d.get(o); err != nil {
-				return fmt.Errorf("failed: %s#%d@%d: %v", word, o, cur, err)
-			} else if w.Word == "" {
-				return fmt.Errorf("failed: %s#%d@%d: empty word", word, o, cur)
-			}
-		}
-	}
-	debug.FreeOSMemory()
-	return nil
-}
-
-// Close closes the files associated with the dictionary file and
-// clears the in-memory index. Usage of the File afterwards
-// may result in a panic.
+// Close closes the files associated with the dictionary file (if it was opened
+// with OpenFile or OpenFileMmap) and clears the in-memory index. Usage of the
+// File afterwards may result in a panic.
 func (d *File) Close() error {
 	d.idx = nil
-	return d.df.Close()
+	if d.close != nil {
+		return d.close()
+	}
+	return nil
 }
 
 // HasWord implements Store.
 func (d *File) HasWord(word string) bool {
-	_, ok := d.idx[word]
+	_, ok, _ := d.idx.Get(word)
 	return ok
 }
 
 // GetWord implements Store, and will return an error if the data structure
 // is invalid or the underlying files are inaccessible.
 func (d *File) GetWords(word string) ([]*Word, bool, error) {
-	cur, ok := d.idx[word]
-	if !ok {
+	cur, ok, err := d.idx.Get(word)
+	if err != nil {
+		return nil, false, fmt.Errorf("get %s: %w", word, err)
+	} else if !ok {
 		return nil, false, nil
 	}
+	ws, err := d.words(word, cur)
+	return ws, true, err
+}
+
+// words gets the words for a headword from its offsets.
+func (d *File) words(word string, cur []size) ([]*Word, error) {
 	ws := make([]*Word, len(cur))
 	for i, o := range cur {
 		if w, err := d.get(o); err != nil {
-			return nil, true, fmt.Errorf("get %s#%d@%d", word, o, i)
+			return nil, fmt.Errorf("get %s#%d@%d: %w", word, o, i, err)
 		} else {
 			ws[i] = w
 		}
 	}
-	return ws, true, nil
+	return ws, nil
+}
+
+// Headwords implements Iterator. The headwords are read directly from the
+// index.
+func (d *File) Headwords(start, prefix string) HeadwordIterator {
+	if start < prefix {
+		start = prefix
+	}
+	return &fileIterator{d: d, it: d.idx.Seek(start), prefix: prefix}
+}
+
+// fileIterator iterates over the headwords in a File.
+type fileIterator struct {
+	d      *File
+	it     indexIter
+	prefix string
+	done   bool
+}
+
+func (it *fileIterator) Next() bool {
+	if it.done || !it.it.Next() || !strings.HasPrefix(it.it.Key(), it.prefix) {
+		it.done = true
+		return false
+	}
+	return true
+}
+
+func (it *fileIterator) Headword() string {
+	return it.it.Key()
+}
+
+func (it *fileIterator) Words() ([]*Word, error) {
+	return it.d.words(it.it.Key(), it.it.Cur())
+}
+
+func (it *fileIterator) Err() error {
+	return it.it.Err()
 }
 
 // GetWord is deprecated.
@@ -349,9 +406,15 @@ func (d *File) GetWord(word string) (*Word, bool, error) {
 	return ws[0], exists, err
 }
 
+// Metadata returns a copy of the metadata, or nil if the file doesn't have
+// any (i.e. it was created before DICT8).
+func (d *File) Metadata() *Metadata {
+	return d.meta.clone()
+}
+
 // NumWords implements Store.
 func (d *File) NumWords() int {
-	return len(d.idx)
+	return d.idx.Len()
 }
 
 // Lookup is a shortcut for Lookup.
@@ -364,27 +427,300 @@ func (d *File) Lookup(word string) (*Word, bool, error) {
 	return Lookup(d, word)
 }
 
-// get retrieves the word at the offset in the dict file.
+// SetCacheSize sets the maximum number of decoded words to keep in memory. If
+// it is zero (the default), the cache is disabled. Words are cached by record,
+// so entries shared between headwords are only cached once. It is safe to call
+// SetCacheSize while the File is in use.
+//
+// Cached words are copied before being returned, so callers may still modify
+// the words returned by GetWords.
+func (d *File) SetCacheSize(n int) {
+	d.cache.Resize(n)
+}
+
+// CacheStats returns statistics about the cache.
+func (d *File) CacheStats() CacheStats {
+	return d.cache.Stats()
+}
+
+// get retrieves the word at the offset in the dict file, using the cache if
+// it is enabled.
 func (d *File) get(cur size) (*Word, error) {
+	if w, ok := d.cache.Get(cur); ok {
+		return w.clone(), nil
+	}
+	w, err := d.read(cur)
+	if err != nil {
+		return nil, err
+	}
+	if d.cache.Enabled() {
+		d.cache.Add(cur, w.clone())
+	}
+	return w, nil
+}
+
+// recordSize reads and checks the size of the record at the offset.
+func (d *File) recordSize(cur size) (int64, error) {
+	o := int64(cur)
+	if o < d.dataOff || o > d.dataEnd-sizew {
+		return 0, formatErr("record", o, ErrOutOfBounds, fmt.Errorf("offset not within %d-%d", d.dataOff, d.dataEnd-sizew))
+	}
+
 	var n int64
-	if err := binary.Read(io.NewSectionReader(d.df, int64(cur), int64(binary.Size(n))), binary.LittleEndian, &n); err != nil {
-		return nil, fmt.Errorf("could not get msgpack length: %v", err)
+	if err := binary.Read(io.NewSectionReader(d.df, o, sizew), binary.LittleEndian, &n); err != nil {
+		return 0, fmt.Errorf("could not get msgpack length: %w", err)
+	}
+
+	min := sizew
+	if d.ver >= 8 {
+		min += crcw
+	}
+	if n < min || n > d.dataEnd-o {
+		return 0, formatErr("record", o, ErrOutOfBounds, fmt.Errorf("size %d not within %d-%d", n, min, d.dataEnd-o))
+	} else if n-min > maxRecordSize {
+		return 0, formatErr("record", o, ErrTooLarge, fmt.Errorf("compressed size is %d bytes", n-min))
 	}
+	return n, nil
+}
 
-	zr, err := zlib.NewReader(io.NewSectionReader(d.df, int64(cur)+sizew, n))
+// read reads the word at the offset in the dict file.
+func (d *File) read(cur size) (*Word, error) {
+	n, err := d.recordSize(cur)
 	if err != nil {
-		return nil, fmt.Errorf("could not decompress msgpack: %v", err)
+		return nil, err
+	}
+
+	if d.ver >= 8 {
+		b, err := d.bytes(int64(cur)+sizew, n-sizew)
+		if err != nil {
+			return nil, fmt.Errorf("could not read record: %w", err)
+		}
+		if exp, act := binary.LittleEndian.Uint32(b), crc32.Checksum(b[crcw:], crcTable); exp != act {
+			return nil, formatErr("record", int64(cur), ErrChecksum, fmt.Errorf("expected %08x, got %08x", exp, act))
+		}
+		return decodeRecord(bytes.NewReader(b[crcw:]), int64(cur))
+	}
+	return decodeRecord(io.NewSectionReader(d.df, int64(cur)+sizew, n-sizew), int64(cur))
+}
+
+// decodeRecord decompresses and decodes the data of the record at the offset
+// (i.e. without the size or checksum).
+func decodeRecord(r io.Reader, off int64) (*Word, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, formatErr("record", off, ErrMalformed, err)
 	}
 	defer zr.Close()
 
 	var w Word
+	lr := &limitReader{r: zr, n: maxRecordSize}
 	if err := func() error {
-		c := msgpack.NewDecoder(zr)
+		c := msgpack.NewDecoder(lr)
 		c.SetCustomStructTag("diskstore")
 		return c.Decode(&w)
 	}(); err != nil {
-		return nil, fmt.Errorf("could not read msgpack: %v", err)
+		if lr.exceeded {
+			return nil, formatErr("record", off, ErrTooLarge, nil)
+		}
+		return nil, formatErr("record", off, ErrMalformed, err)
 	}
 
 	return &w, nil
 }
+
+// bytes reads part of the dict file into memory, or slices it directly if it
+// is memory-mapped. The range must have already been checked.
+func (d *File) bytes(off, n int64) ([]byte, error) {
+	if s, ok := d.df.(slicer); ok {
+		return s.slice(off, n)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("invalid size %d", n)
+	}
+	b := make([]byte, n)
+	if r, err := d.df.ReadAt(b, off); r != len(b) {
+		return nil, err
+	}
+	return b, nil
+}
+
+// section gets a section by its tag.
+func (d *File) section(tag string) (section, bool) {
+	for _, sec := range d.sections {
+		if sec.Name() == tag {
+			return sec, true
+		}
+	}
+	return section{}, false
+}
+
+// index maps headwords to the offsets of their records.
+type index interface {
+	// Len returns the number of headwords.
+	Len() int
+	// Get gets the offsets for a headword.
+	Get(word string) ([]size, bool, error)
+	// Each calls fn for each headword until it returns an error.
+	Each(fn func(word string, cur []size) error) error
+	// Seek returns an iterator positioned before the first headword greater
+	// than or equal to word.
+	Seek(word string) indexIter
+}
+
+// indexIter iterates over an index in sorted order.
+type indexIter interface {
+	Next() bool
+	Key() string
+	Cur() []size
+	Err() error
+}
+
+// mapIndex is an in-memory index used for DICT5 and DICT6 files.
+type mapIndex struct {
+	m    map[string][]size
+	keys []string // sorted
+}
+
+func newMapIndex(m map[string][]size) mapIndex {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return mapIndex{m, keys}
+}
+
+func (idx mapIndex) Len() int {
+	return len(idx.m)
+}
+
+func (idx mapIndex) Get(word string) ([]size, bool, error) {
+	cur, ok := idx.m[word]
+	return cur, ok, nil
+}
+
+func (idx mapIndex) Each(fn func(word string, cur []size) error) error {
+	for word, cur := range idx.m {
+		if err := fn(word, cur); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx mapIndex) Seek(word string) indexIter {
+	return &mapIndexIter{idx, sort.SearchStrings(idx.keys, word) - 1}
+}
+
+type mapIndexIter struct {
+	idx mapIndex
+	i   int
+}
+
+func (it *mapIndexIter) Next() bool {
+	if it.i+1 >= len(it.idx.keys) {
+		it.i = len(it.idx.keys)
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *mapIndexIter) Key() string {
+	return it.idx.keys[it.i]
+}
+
+func (it *mapIndexIter) Cur() []size {
+	return it.idx.m[it.idx.keys[it.i]]
+}
+
+func (it *mapIndexIter) Err() error {
+	return nil
+}
+
+// tableIndex is a keyTable index used for DICT7 and later files.
+type tableIndex struct {
+	t   *keyTable
+	off int64 // for errors
+}
+
+func (idx tableIndex) Len() int {
+	return idx.t.Len()
+}
+
+func (idx tableIndex) Get(word string) ([]size, bool, error) {
+	vals, ok, err := idx.t.Get(word)
+	if err != nil {
+		return nil, false, formatErr("idx", idx.off, ErrMalformed, err)
+	} else if !ok {
+		return nil, false, nil
+	}
+	return sizes(vals), true, nil
+}
+
+func (idx tableIndex) Each(fn func(word string, cur []size) error) error {
+	it := idx.Seek("")
+	for it.Next() {
+		if err := fn(it.Key(), it.Cur()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func (idx tableIndex) Seek(word string) indexIter {
+	return tableIndexIter{idx.t.Seek(word), idx.off}
+}
+
+type tableIndexIter struct {
+	*keyTableIter
+	off int64
+}
+
+func (it tableIndexIter) Cur() []size {
+	return sizes(it.Values())
+}
+
+func (it tableIndexIter) Err() error {
+	if err := it.keyTableIter.Err(); err != nil {
+		return formatErr("idx", it.off, ErrMalformed, err)
+	}
+	return nil
+}
+
+func sizes(vals []uint64) []size {
+	cur := make([]size, len(vals))
+	for i, v := range vals {
+		cur[i] = size(v)
+	}
+	return cur
+}
+
+// slicer is implemented by readers which can return part of their contents
+// without copying it.
+type slicer interface {
+	slice(off, n int64) ([]byte, error)
+}
+
+// byteFile reads from a byte slice. It is used for OpenBytes and OpenFileMmap.
+type byteFile []byte
+
+func (b byteFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	} else if off >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b byteFile) slice(off, n int64) ([]byte, error) {
+	if off < 0 || n < 0 || off > int64(len(b)) || n > int64(len(b))-off {
+		return nil, fmt.Errorf("range %d+%d out of bounds", off, n)
+	}
+	return b[off : off+n : off+n], nil
+}
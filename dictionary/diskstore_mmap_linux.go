@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package dictionary
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// OpenFileMmap is like OpenFile, but it memory-maps the whole dict file rather
+// than reading it with a syscall for every lookup. The index and records are
+// served directly from the page cache.
+//
+// The mapping is removed by Close. Unlike OpenFile, using the File after it has
+// been closed will crash the program rather than returning an error.
+func OpenFileMmap(dictfile string) (*File, error) {
+	f, err := os.OpenFile(dictfile, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open db: %v", err)
+	}
+	defer f.Close() // the mapping stays valid after the file is closed
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("could not stat db: %v", err)
+	}
+
+	sz := fi.Size()
+	if sz == 0 {
+		return nil, formatErr("version", 0, ErrOutOfBounds, fmt.Errorf("file is empty"))
+	} else if int64(int(sz)) != sz {
+		return nil, fmt.Errorf("could not map db: file too large (%d bytes)", sz)
+	}
+
+	b, err := syscall.Mmap(int(f.Fd()), 0, int(sz), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("could not map db: %v", err)
+	}
+
+	m := &mmapFile{b}
+	d, err := openFile(m.b, sz)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	d.close = m.Close
+	return d, nil
+}
+
+// mmapFile is a read-only memory mapping.
+type mmapFile struct {
+	b byteFile
+}
+
+func (m *mmapFile) Close() error {
+	if m.b == nil {
+		return nil
+	}
+	b := m.b
+	m.b = nil
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package dictionary
+
+// OpenFileMmap is the same as OpenFile on platforms other than Linux.
+func OpenFileMmap(dictfile string) (*File, error) {
+	return OpenFile(dictfile)
+}
@@ -0,0 +1,328 @@
+package dictionary
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Writer writes a dict file incrementally. Records are written to the file as
+// they are added, and only the index is kept in memory until Close, so large
+// dictionaries can be created without holding every Word in memory at once
+// (unlike with CreateFile, which needs a WordMap).
+//
+// A Writer is not safe for concurrent use. The file is not valid until Close
+// returns successfully.
+type Writer struct {
+	f    *os.File
+	bw   *bufio.Writer
+	off  int64 // current offset in the file
+	idx  map[string]*writerEntry
+	infl map[string][]uint64 // inflected forms
+	err  error               // first error, if any
+	buf  bytes.Buffer
+	zw   *zlib.Writer
+	data hash.Hash // sha256 of the data section so far
+	secs []section
+	meta *Metadata
+	text *textIndexBuilder // if enabled
+	n    int               // number of records
+}
+
+// writerEntry contains the records for a headword in the order they will be
+// written to the index.
+type writerEntry struct {
+	primary []uint64
+	variant []uint64
+}
+
+// CreateWriter creates a dict file for writing. The file will be overwritten
+// if it exists.
+func CreateWriter(dictfile string) (*Writer, error) {
+	f, err := os.Create(dictfile)
+	if err != nil {
+		return nil, fmt.Errorf("could not create db: %v", err)
+	}
+
+	w := &Writer{
+		f:    f,
+		bw:   bufio.NewWriter(f),
+		idx:  map[string]*writerEntry{},
+		infl: map[string][]uint64{},
+		data: sha256.New(),
+	}
+
+	// the version and section table are left zeroed until the file is complete
+	if _, err := w.bw.Write(make([]byte, sectionHeaderSize())); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not write header placeholder: %v", err)
+	}
+	w.off = sectionHeaderSize()
+
+	return w, nil
+}
+
+// Add writes an entry to the file and adds it to the index for each of the
+// headwords. The first headword is treated as the primary one, and the rest are
+// treated as variants.
+//
+// For each headword, the entries it is the primary headword of will be
+// returned before the ones it is a variant of, and each group is kept in the
+// order it was added. This is the same ordering Parse uses, and means that
+// entries can be added as they are read from the source.
+func (w *Writer) Add(headwords []string, word *Word) error {
+	if len(headwords) == 0 {
+		return fmt.Errorf("no headwords for entry")
+	}
+	cur, err := w.write(word)
+	if err != nil {
+		return fmt.Errorf("could not write entry for %#v: %v", headwords[0], err)
+	}
+	for i, h := range headwords {
+		if dup := func() bool {
+			for _, x := range headwords[:i] {
+				if x == h {
+					return true
+				}
+			}
+			return false
+		}(); !dup {
+			w.link(h, cur, i == 0)
+		}
+	}
+	return nil
+}
+
+// AddWordMap adds every entry in a WordMap. Entries referenced by multiple
+// headwords are only written once, and the order of the entries for each
+// headword is preserved exactly (i.e. it does not use the ordering described
+// in Add). The records are written in order of their first headword, so the
+// output is deterministic.
+func (w *Writer) AddWordMap(wm WordMap) error {
+	keys := make([]string, 0, len(wm))
+	for k := range wm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rev := map[*Word]size{}
+	for _, k := range keys {
+		for _, word := range wm[k] {
+			cur, ok := rev[word]
+			if !ok {
+				var err error
+				if cur, err = w.write(word); err != nil {
+					return fmt.Errorf("could not write entry for %#v: %v", k, err)
+				}
+				rev[word] = cur
+			}
+			w.link(k, cur, true)
+		}
+	}
+	return nil
+}
+
+// SetMetadata sets the metadata to write to the file. The Headwords and
+// Entries fields will be set automatically. If it is not called, the metadata
+// will only contain the counts.
+func (w *Writer) SetMetadata(m *Metadata) {
+	w.meta = m.clone()
+}
+
+// EnableTextIndex enables building an inverted index of the text of the
+// entries, which is used for Search. It must be called before any entries are
+// added. Note that the index is kept in memory until Close.
+func (w *Writer) EnableTextIndex() error {
+	if w.n != 0 {
+		return fmt.Errorf("entries have already been added")
+	}
+	if w.text == nil {
+		w.text = newTextIndexBuilder()
+	}
+	return nil
+}
+
+// Close writes the index and header, then closes the file. If Close is called
+// more than once, it does nothing and returns the first error.
+func (w *Writer) Close() error {
+	if w.f == nil {
+		return w.err
+	}
+	defer func() {
+		w.f.Close()
+		w.f = nil
+	}()
+	if w.err != nil {
+		return w.err
+	}
+
+	w.secs = append(w.secs, section{
+		Offset: sectionHeaderSize(),
+		Size:   w.off - sectionHeaderSize(),
+	})
+	copy(w.secs[0].Tag[:], sectionData)
+	copy(w.secs[0].Sum[:], w.data.Sum(nil))
+
+	idx := make(map[string][]uint64, len(w.idx))
+	for k, e := range w.idx {
+		idx[k] = append(e.primary, e.variant...)
+	}
+	w.idx = nil
+
+	meta := w.meta
+	if meta == nil {
+		meta = &Metadata{}
+	}
+	meta.Headwords, meta.Entries = len(idx), w.n
+
+	if err := w.section(sectionIdx, encodeKeyTable(idx)); err != nil {
+		return w.fail(fmt.Errorf("could not write idx: %v", err))
+	} else if b, err := encodeMetadata(meta); err != nil {
+		return w.fail(fmt.Errorf("could not encode metadata: %v", err))
+	} else if err := w.section(sectionMeta, b); err != nil {
+		return w.fail(fmt.Errorf("could not write metadata: %v", err))
+	}
+
+	if len(w.infl) != 0 {
+		b := encodeKeyTable(w.infl)
+		w.infl = nil
+		if err := w.section(sectionInfl, b); err != nil {
+			return w.fail(fmt.Errorf("could not write inflection index: %v", err))
+		}
+	}
+
+	if w.text != nil {
+		b := w.text.encode()
+		w.text = nil
+		if err := w.section(sectionText, b); err != nil {
+			return w.fail(fmt.Errorf("could not write text index: %v", err))
+		}
+	}
+
+	if err := w.bw.Flush(); err != nil {
+		return w.fail(fmt.Errorf("could not write file: %v", err))
+	}
+
+	if _, err := w.f.Seek(int64(len(FileVer)), io.SeekStart); err != nil {
+		return w.fail(fmt.Errorf("could not seek to section table placeholder: %v", err))
+	} else if err := writeSections(w.f, w.secs); err != nil {
+		return w.fail(fmt.Errorf("could not write section table: %v", err))
+	}
+
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return w.fail(fmt.Errorf("could not seek to version placeholder: %v", err))
+	} else if _, err := w.f.WriteString(FileVer); err != nil {
+		return w.fail(fmt.Errorf("could not write version: %v", err))
+	}
+
+	if err := w.f.Sync(); err != nil {
+		return w.fail(fmt.Errorf("could not write file: %v", err))
+	} else if err := w.f.Close(); err != nil {
+		return w.fail(fmt.Errorf("could not write file: %v", err))
+	}
+	return nil
+}
+
+// write writes a record and returns its offset.
+func (w *Writer) write(word *Word) (size, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf.Reset()
+	if w.zw == nil {
+		zw, err := zlib.NewWriterLevel(&w.buf, zlib.BestCompression)
+		if err != nil {
+			return 0, w.fail(fmt.Errorf("could not compress word: %v", err))
+		}
+		w.zw = zw
+	} else {
+		w.zw.Reset(&w.buf)
+	}
+
+	e := msgpack.NewEncoder(w.zw)
+	e.SetCustomStructTag("diskstore")
+	if err := e.Encode(word); err != nil {
+		return 0, w.fail(fmt.Errorf("could not encode word: %v", err))
+	} else if err := w.zw.Close(); err != nil {
+		return 0, w.fail(fmt.Errorf("could not compress word: %v", err))
+	}
+
+	hdr := make([]byte, sizew+crcw)
+	binary.LittleEndian.PutUint64(hdr, uint64(sizew+crcw+int64(w.buf.Len())))
+	binary.LittleEndian.PutUint32(hdr[sizew:], crc32.Checksum(w.buf.Bytes(), crcTable))
+	w.data.Write(hdr)
+	w.data.Write(w.buf.Bytes())
+
+	cur := size(w.off)
+	if _, err := w.bw.Write(hdr); err != nil {
+		return 0, w.fail(fmt.Errorf("could not write word header: %v", err))
+	} else if _, err := w.bw.Write(w.buf.Bytes()); err != nil {
+		return 0, w.fail(fmt.Errorf("could not write word: %v", err))
+	}
+	w.off += int64(len(hdr)) + int64(w.buf.Len())
+	w.n++
+
+	for _, f := range word.Inflections {
+		if c := w.infl[f.Form]; len(c) == 0 || c[len(c)-1] != uint64(cur) {
+			w.infl[f.Form] = append(c, uint64(cur))
+		}
+	}
+
+	if w.text != nil {
+		w.text.add(cur, word)
+	}
+
+	return cur, nil
+}
+
+// section writes a section after the data and adds it to the section table.
+func (w *Writer) section(tag string, b []byte) error {
+	if len(tag) != 4 {
+		panic("bug: invalid section tag")
+	}
+	sec := section{
+		Offset: w.off,
+		Size:   int64(len(b)),
+		Sum:    sha256.Sum256(b),
+	}
+	copy(sec.Tag[:], tag)
+	if _, err := w.bw.Write(b); err != nil {
+		return err
+	}
+	w.off += int64(len(b))
+	w.secs = append(w.secs, sec)
+	return nil
+}
+
+// link adds a record to the index for a headword.
+func (w *Writer) link(headword string, cur size, primary bool) {
+	e, ok := w.idx[headword]
+	if !ok {
+		e = &writerEntry{}
+		w.idx[headword] = e
+	}
+	if primary {
+		e.primary = append(e.primary, uint64(cur))
+	} else {
+		e.variant = append(e.variant, uint64(cur))
+	}
+}
+
+// fail sets the error if it is the first one, then returns it.
+func (w *Writer) fail(err error) error {
+	if w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
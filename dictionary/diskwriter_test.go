@@ -0,0 +1,196 @@
+package dictionary
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateFileDeterministic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dictserver")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := WordMap{}
+	for _, w := range testWriterWords() {
+		for _, hw := range w.headwords {
+			wm[hw] = append(wm[hw], w.word)
+		}
+	}
+	var keys []string
+	for k := range wm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// copies of the same WordMap, with the keys inserted in different orders
+	build := func(name string, reverse bool) []byte {
+		c := WordMap{}
+		for i := range keys {
+			if reverse {
+				i = len(keys) - 1 - i
+			}
+			c[keys[i]] = wm[keys[i]]
+		}
+		fn := filepath.Join(dir, name)
+		if err := CreateFile(c, fn); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		buf, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		return buf
+	}
+
+	a := build("a.dict", false)
+	b := build("b.dict", true)
+	if !bytes.Equal(a, b) {
+		t.Errorf("files built from the same WordMap differ")
+	}
+
+	d, err := OpenBytes(a)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer d.Close()
+
+	// CreateFile preserves the order in the WordMap
+	ws, ok, err := d.GetWords("lead")
+	if err != nil || !ok {
+		t.Fatalf("get lead: %v %v", ok, err)
+	}
+	var got []string
+	for _, w := range ws {
+		got = append(got, w.Info)
+	}
+	if exp := []string{"Lead, n.", "Lead, v. t."}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected lead entries %q, got %q", exp, got)
+	}
+}
+
+func TestWriterDeterministic(t *testing.T) {
+	if a, b := testWriterFile(t), testWriterFile(t); !bytes.Equal(a, b) {
+		t.Errorf("files built from the same entries differ")
+	}
+}
+
+func TestFileChecksums(t *testing.T) {
+	buf := testWriterFile(t)
+
+	d, err := OpenBytes(buf)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, w := range testWriterWords() {
+		for _, hw := range w.headwords {
+			ws, ok, err := d.GetWords(hw)
+			if err != nil || !ok {
+				t.Errorf("get %s: %v %v", hw, ok, err)
+				continue
+			}
+			var found bool
+			for _, x := range ws {
+				found = found || reflect.DeepEqual(x, w.word)
+			}
+			if !found {
+				t.Errorf("get %s: entry %q not returned", hw, w.word.Info)
+			}
+		}
+	}
+	if err := d.Verify(); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	idx, _ := d.section(sectionIdx)
+	cur, _, _ := d.idx.Get("zebra")
+	d.Close()
+
+	// a byte in the compressed data of a record
+	b := append([]byte{}, buf...)
+	b[int64(cur[0])+sizew+crcw+2] ^= 0xFF
+	if d, err := OpenBytes(b); err != nil {
+		t.Errorf("corrupt record: open: %v", err)
+	} else {
+		var fe *FormatError
+		if _, _, err := d.GetWords("zebra"); !errors.As(err, &fe) || fe.Kind != ErrChecksum || fe.Part != "record" || fe.Offset != int64(cur[0]) {
+			t.Errorf("corrupt record: expected record checksum error at %d, got %v", cur[0], err)
+		}
+		if _, _, err := d.GetWords("lead"); err != nil {
+			t.Errorf("corrupt record: other records should still be readable, got %v", err)
+		}
+		d.Close()
+	}
+
+	// a byte in the idx section
+	b = append([]byte{}, buf...)
+	b[idx.Offset+idx.Size/2] ^= 0xFF
+	var fe *FormatError
+	if _, err := OpenBytes(b); !errors.As(err, &fe) || fe.Kind != ErrChecksum || fe.Part != "idx" || fe.Offset != idx.Offset || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("corrupt idx: expected idx digest mismatch, got %v", err)
+	}
+}
+
+// testWriterFile creates a dict file with a text index and metadata from
+// testWriterWords.
+func testWriterFile(t *testing.T) []byte {
+	dir, err := ioutil.TempDir("", "dictserver")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "test.dict")
+	dw, err := CreateWriter(fn)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer dw.Close()
+
+	if err := dw.EnableTextIndex(); err != nil {
+		t.Fatalf("enable text index: %v", err)
+	}
+	dw.SetMetadata(&Metadata{
+		Title:     "Test",
+		BuildTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	for _, w := range testWriterWords() {
+		if err := dw.Add(w.headwords, w.word); err != nil {
+			t.Fatalf("add %s: %v", w.headwords[0], err)
+		}
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return buf
+}
+
+type testWriterWord struct {
+	headwords []string // the first one is primary, the rest are variants
+	word      *Word
+}
+
+// testWriterWords returns entries with variants and multiple entries for the
+// same headword.
+func testWriterWords() []testWriterWord {
+	return []testWriterWord{
+		{[]string{"lead"}, &Word{Word: "lead", Info: "Lead, n.", Meanings: []WordMeaning{{Text: "A heavy metal."}}}},
+		{[]string{"lead", "led"}, &Word{Word: "lead", Info: "Lead, v. t.", Meanings: []WordMeaning{{Text: "To guide."}}}},
+		{[]string{"colour", "color"}, &Word{Word: "colour", Alternates: []string{"color"}, Info: "Col\"our, n.", Meanings: []WordMeaning{{Text: "A hue."}}}},
+		{[]string{"color"}, &Word{Word: "color", Info: "Col\"or, v. t.", Meanings: []WordMeaning{{Text: "To paint."}}}},
+		{[]string{"zebra"}, &Word{Word: "zebra", Info: "Ze\"bra, n.", Meanings: []WordMeaning{{Text: "A striped animal."}}}},
+	}
+}
@@ -0,0 +1,89 @@
+package dictionary
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kinds of FormatError. Use errors.Is to check for them.
+var (
+	ErrIncomplete  = errors.New("incomplete file (did it create successfully?)")
+	ErrVersion     = errors.New("incompatible file version")
+	ErrOutOfBounds = errors.New("offset or size out of bounds")
+	ErrTooLarge    = errors.New("data too large")
+	ErrChecksum    = errors.New("checksum mismatch")
+	ErrMalformed   = errors.New("malformed data")
+)
+
+// Limits for reading dict files. They are much larger than anything a real
+// dictionary needs, but prevent malformed files from causing huge allocations.
+const (
+	maxRecordSize = 16 << 20 // compressed or decompressed record
+	maxIdxSize    = 1 << 30  // decompressed DICT5/DICT6 idx
+	maxMetaSize   = 1 << 20  // metadata section
+)
+
+// FormatError is returned when a dict file is malformed, corrupt, or exceeds
+// the limits on the size of its contents.
+type FormatError struct {
+	Part   string // the part being read (e.g. version, section table, idx, record)
+	Offset int64  // the offset of the part, or -1 if it is not known
+	Kind   error  // one of the Err* values
+	Err    error  // more details, if any
+}
+
+func formatErr(part string, off int64, kind error, err error) *FormatError {
+	return &FormatError{part, off, kind, err}
+}
+
+func (e *FormatError) Error() string {
+	var b strings.Builder
+	b.WriteString("could not read ")
+	b.WriteString(e.Part)
+	if e.Offset >= 0 {
+		fmt.Fprintf(&b, " at %d", e.Offset)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Kind.Error())
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+// Is checks if the error is of the specified kind.
+func (e *FormatError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// limitReader is like io.LimitedReader, but it remembers whether there was
+// more data than the limit.
+type limitReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var b [1]byte
+		if n, _ := l.r.Read(b[:]); n != 0 {
+			l.exceeded = true
+			return 0, ErrTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
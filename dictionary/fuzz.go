@@ -0,0 +1,47 @@
+//go:build gofuzz
+// +build gofuzz
+
+package dictionary
+
+import (
+	"bytes"
+)
+
+// Entry points for go-fuzz (github.com/dvyukov/go-fuzz). Existing dict files
+// make a good seed corpus for FuzzOpenBytes. For example:
+//
+//   go-fuzz-build -func FuzzOpenBytes github.com/pgaskin/dictserver/dictionary
+//   mkdir -p fuzz/open/corpus && cp dict fuzz/open/corpus/
+//   go-fuzz -bin dictionary-fuzz.zip -workdir fuzz/open
+//
+// FuzzDecodeRecord takes the zlib-compressed msgpack data of a single record,
+// and doesn't need a seed corpus.
+
+// FuzzOpenBytes opens a dict file and reads every entry.
+func FuzzOpenBytes(data []byte) int {
+	d, err := OpenBytes(data)
+	if err != nil {
+		return 0
+	}
+	defer d.Close()
+
+	d.Verify()
+
+	it := d.Headwords("", "")
+	for it.Next() {
+		if _, err := it.Words(); err != nil {
+			break
+		}
+	}
+	d.Lemmas("a")
+	d.Search("a b", 10)
+	return 1
+}
+
+// FuzzDecodeRecord decodes the data of a record (after the size and checksum).
+func FuzzDecodeRecord(data []byte) int {
+	if _, err := decodeRecord(bytes.NewReader(data), 0); err != nil {
+		return 0
+	}
+	return 1
+}
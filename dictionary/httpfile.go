@@ -0,0 +1,342 @@
+package dictionary
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HTTPOptions configures a HTTPFile.
+type HTTPOptions struct {
+	Client    *http.Client // the client to use (default: http.DefaultClient)
+	BlockSize int          // the number of bytes to request at a time (default: 64 KiB)
+	CacheSize int          // the maximum number of blocks to cache (default: 256)
+}
+
+// HTTPStats contains statistics about a HTTPFile.
+type HTTPStats struct {
+	Requests uint64 // range requests made
+	Bytes    uint64 // bytes downloaded
+	Hits     uint64 // blocks served from the cache
+	Misses   uint64 // blocks which needed to be downloaded
+}
+
+// HTTPFile is an io.ReaderAt which reads a remote file on demand using HTTP
+// range requests. It is safe for concurrent use.
+//
+// The file is read in blocks of BlockSize, which are kept in a LRU cache.
+// Consecutive blocks which aren't cached are downloaded with a single request,
+// and concurrent reads of the same block share a request. If the remote file
+// changes (i.e. the ETag or Last-Modified header changes), reads will fail.
+type HTTPFile struct {
+	url       string
+	client    *http.Client
+	bs        int64
+	sz        int64
+	validator string // for If-Range
+
+	mu       sync.Mutex
+	csize    int
+	ll       *list.List // of *httpBlock, most recently used first
+	blocks   map[int64]*list.Element
+	inflight map[int64]*httpFetch
+	stats    HTTPStats
+}
+
+type httpBlock struct {
+	i int64
+	b []byte
+}
+
+// httpFetch is a block being downloaded.
+type httpFetch struct {
+	done chan struct{}
+	b    []byte
+	err  error
+}
+
+// OpenURL opens a dictionary from a HTTP server which supports range requests
+// using a HTTPFile. Only the header and the index are downloaded initially.
+func OpenURL(url string, opt HTTPOptions) (*File, error) {
+	f, err := NewHTTPFile(url, opt)
+	if err != nil {
+		return nil, err
+	}
+	return Open(f, f.Size())
+}
+
+// NewHTTPFile creates a new HTTPFile. The first block is requested to check if
+// range requests are supported and to get the size of the file.
+func NewHTTPFile(url string, opt HTTPOptions) (*HTTPFile, error) {
+	f := &HTTPFile{
+		url:      url,
+		client:   opt.Client,
+		bs:       int64(opt.BlockSize),
+		csize:    opt.CacheSize,
+		ll:       list.New(),
+		blocks:   map[int64]*list.Element{},
+		inflight: map[int64]*httpFetch{},
+	}
+	if f.client == nil {
+		f.client = http.DefaultClient
+	}
+	if f.bs <= 0 {
+		f.bs = 64 * 1024
+	}
+	if f.csize <= 0 {
+		f.csize = 256
+	}
+
+	resp, err := f.request(0, f.bs)
+	if errors.Is(err, errRemoteEmpty) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if f.sz, err = f.total(resp, 0); err != nil {
+		return nil, err
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		f.validator = etag
+	} else if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		f.validator = lm
+	}
+
+	if n := f.bs; f.sz != 0 {
+		if n > f.sz {
+			n = f.sz
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(resp.Body, b); err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", url, err)
+		}
+		f.stats.Bytes += uint64(n)
+		f.add(0, b)
+	}
+	return f, nil
+}
+
+// Size returns the size of the remote file.
+func (f *HTTPFile) Size() int64 {
+	return f.sz
+}
+
+// Stats returns the current statistics.
+func (f *HTTPFile) Stats() HTTPStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stats
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *HTTPFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	} else if off >= f.sz {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(p))
+	if end > f.sz {
+		end = f.sz
+	}
+	if end == off {
+		return 0, nil
+	}
+	first, last := off/f.bs, (end-1)/f.bs
+
+	// get the cached blocks, and start fetching the missing ones
+	blocks := make([][]byte, last-first+1)
+	fetches := make([]*httpFetch, last-first+1)
+	var runs [][2]int64 // of missing blocks [start, end)
+	f.mu.Lock()
+	for i := first; i <= last; i++ {
+		if e, ok := f.blocks[i]; ok {
+			f.stats.Hits++
+			f.ll.MoveToFront(e)
+			blocks[i-first] = e.Value.(*httpBlock).b
+		} else if h, ok := f.inflight[i]; ok {
+			f.stats.Hits++
+			fetches[i-first] = h
+		} else {
+			f.stats.Misses++
+			h := &httpFetch{done: make(chan struct{})}
+			f.inflight[i] = h
+			fetches[i-first] = h
+			if n := len(runs); n != 0 && runs[n-1][1] == i {
+				runs[n-1][1]++
+			} else {
+				runs = append(runs, [2]int64{i, i + 1})
+			}
+		}
+	}
+	f.mu.Unlock()
+
+	for _, r := range runs {
+		f.fetch(r[0], r[1])
+	}
+
+	var err error
+	for i, h := range fetches {
+		if h != nil {
+			<-h.done
+			if h.err != nil {
+				err = h.err
+				break
+			}
+			blocks[i] = h.b
+		}
+	}
+
+	var n int
+	for i, b := range blocks {
+		if err != nil && b == nil {
+			break
+		}
+		bo := (first + int64(i)) * f.bs
+		if i == 0 {
+			b = b[off-bo:]
+		}
+		n += copy(p[n:], b)
+	}
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// fetch downloads the blocks [first, last), and finishes the in-flight fetches
+// for them.
+func (f *HTTPFile) fetch(first, last int64) {
+	start, end := first*f.bs, last*f.bs
+	if end > f.sz {
+		end = f.sz
+	}
+
+	buf, err := func() ([]byte, error) {
+		resp, err := f.request(start, end-start)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if _, err := f.total(resp, start); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, end-start)
+		if _, err := io.ReadFull(resp.Body, buf); err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", f.url, err)
+		}
+		return buf, nil
+	}()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		f.stats.Bytes += uint64(len(buf))
+	}
+	for i := first; i < last; i++ {
+		h := f.inflight[i]
+		delete(f.inflight, i)
+		if err != nil {
+			h.err = err
+		} else {
+			bo := (i - first) * f.bs
+			be := bo + f.bs
+			if be > int64(len(buf)) {
+				be = int64(len(buf))
+			}
+			h.b = buf[bo:be:be]
+			f.addLocked(i, h.b)
+		}
+		close(h.done)
+	}
+}
+
+// request makes a range request for n bytes at off.
+func (f *HTTPFile) request(off, n int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not request %s: %w", f.url, err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	if f.validator != "" {
+		req.Header.Set("If-Range", f.validator)
+	}
+
+	f.mu.Lock()
+	f.stats.Requests++
+	f.mu.Unlock()
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not request %s: %w", f.url, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp, nil
+	case http.StatusOK:
+		resp.Body.Close()
+		if f.sz == 0 && resp.ContentLength == 0 {
+			return nil, errRemoteEmpty // the range is ignored for empty files by some servers
+		}
+		if f.validator != "" {
+			return nil, fmt.Errorf("could not request %s: %w", f.url, errRemoteChanged)
+		}
+		return nil, fmt.Errorf("could not request %s: server does not support range requests", f.url)
+	default:
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if f.sz == 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && resp.Header.Get("Content-Range") == "bytes */0" {
+			return nil, errRemoteEmpty
+		}
+		return nil, fmt.Errorf("could not request %s: response status %s", f.url, resp.Status)
+	}
+}
+
+// total gets the total size from the Content-Range of a response, and checks
+// the range starts at off and the size matches the known size.
+func (f *HTTPFile) total(resp *http.Response, off int64) (int64, error) {
+	cr := resp.Header.Get("Content-Range")
+	var start, end, sz int64
+	if n, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &sz); err != nil || n != 3 || start != off || end < start || sz <= end {
+		return 0, fmt.Errorf("could not request %s: unexpected Content-Range %q", f.url, cr)
+	}
+	if f.sz != 0 && sz != f.sz {
+		return 0, fmt.Errorf("could not request %s: %w", f.url, errRemoteChanged)
+	}
+	return sz, nil
+}
+
+var (
+	errRemoteChanged = errors.New("remote file has changed")
+	errRemoteEmpty   = errors.New("remote file is empty")
+)
+
+// add adds a block to the cache.
+func (f *HTTPFile) add(i int64, b []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addLocked(i, b)
+}
+
+func (f *HTTPFile) addLocked(i int64, b []byte) {
+	if e, ok := f.blocks[i]; ok {
+		f.ll.MoveToFront(e)
+		e.Value.(*httpBlock).b = b
+		return
+	}
+	f.blocks[i] = f.ll.PushFront(&httpBlock{i, b})
+	for f.ll.Len() > f.csize {
+		e := f.ll.Back()
+		f.ll.Remove(e)
+		delete(f.blocks, e.Value.(*httpBlock).i)
+	}
+}
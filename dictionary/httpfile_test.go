@@ -0,0 +1,343 @@
+package dictionary
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testHTTPServer serves a file which can be replaced while it is being read.
+type testHTTPServer struct {
+	mu      sync.Mutex
+	content []byte
+	etag    string
+	ranges  []string // the Range header of each request
+}
+
+func (s *testHTTPServer) set(content []byte, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content, s.etag = content, etag
+}
+
+func (s *testHTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	content, etag := s.content, s.etag
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.mu.Unlock()
+
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeContent(w, r, "dict", time.Time{}, bytes.NewReader(content))
+}
+
+func testHTTPContent(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func TestHTTPFileReadAt(t *testing.T) {
+	content := testHTTPContent(1000)
+	s := &testHTTPServer{}
+	s.set(content, `"v1"`)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// 16 blocks, the last one being 40 bytes
+	f, err := NewHTTPFile(srv.URL, HTTPOptions{BlockSize: 64, CacheSize: 8})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if f.Size() != int64(len(content)) {
+		t.Fatalf("expected size %d, got %d", len(content), f.Size())
+	}
+
+	for _, c := range []struct {
+		off, n int
+		reqs   uint64 // new requests
+	}{
+		{0, 10, 0},    // block 0 is fetched when opening
+		{100, 200, 1}, // blocks 1-4 in one request
+		{150, 50, 0},  // cached
+		{63, 2, 0},    // across cached blocks
+		{960, 100, 1}, // block 15, past the end (EOF)
+		{1000, 10, 0}, // at the end (EOF)
+		{5000, 10, 0}, // after the end (EOF)
+		{700, 0, 0},   // nothing
+		{290, 100, 1}, // block 4 is cached, 5-6 in one request
+		{500, 10, 1},  // block 7 evicts the least recently used one (2)
+		{990, 10, 0},  // block 15 is still cached
+		{0, 1000, 2},  // blocks 2 and 8-14 are missing
+	} {
+		before := f.Stats().Requests
+		p := make([]byte, c.n)
+		n, err := f.ReadAt(p, int64(c.off))
+
+		exp := []byte{}
+		if c.off < len(content) {
+			exp = content[c.off:]
+			if len(exp) > c.n {
+				exp = exp[:c.n]
+			}
+		}
+		if n != len(exp) || !bytes.Equal(p[:n], exp) {
+			t.Errorf("read %d@%d: expected %d bytes, got %d (or incorrect data)", c.n, c.off, len(exp), n)
+		}
+		if (n < c.n) != (err == io.EOF) {
+			t.Errorf("read %d@%d: expected io.EOF iff short read, got %v", c.n, c.off, err)
+		} else if err != nil && err != io.EOF {
+			t.Errorf("read %d@%d: unexpected error: %v", c.n, c.off, err)
+		}
+		if reqs := f.Stats().Requests - before; reqs != c.reqs {
+			t.Errorf("read %d@%d: expected %d requests, got %d", c.n, c.off, c.reqs, reqs)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if exp := "bytes=64-319"; s.ranges[1] != exp {
+		t.Errorf("expected blocks to be coalesced into %q, got %q", exp, s.ranges[1])
+	}
+}
+
+func TestHTTPFileConcurrent(t *testing.T) {
+	content := testHTTPContent(10000)
+	s := &testHTTPServer{}
+	s.set(content, `"v1"`)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	f, err := NewHTTPFile(srv.URL, HTTPOptions{BlockSize: 100, CacheSize: 20})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < 200; j++ {
+				off, n := r.Intn(len(content)), r.Intn(500)
+				if off+n > len(content) {
+					n = len(content) - off
+				}
+				p := make([]byte, n)
+				if _, err := f.ReadAt(p, int64(off)); err != nil && err != io.EOF {
+					t.Errorf("read %d@%d: %v", n, off, err)
+					return
+				}
+				if !bytes.Equal(p, content[off:off+n]) {
+					t.Errorf("read %d@%d: incorrect data", n, off)
+					return
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+}
+
+func TestHTTPFileNoRange(t *testing.T) {
+	content := testHTTPContent(1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content) // ignores the Range header
+	}))
+	defer srv.Close()
+
+	if _, err := NewHTTPFile(srv.URL, HTTPOptions{BlockSize: 64}); err == nil || !strings.Contains(err.Error(), "does not support range requests") {
+		t.Errorf("expected range requests to be unsupported, got %v", err)
+	}
+}
+
+func TestHTTPFileEmpty(t *testing.T) {
+	for _, c := range []struct {
+		what    string
+		handler http.HandlerFunc
+	}{
+		{"ServeContent", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "dict", time.Time{}, bytes.NewReader(nil))
+		}},
+		{"416", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes */0")
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		}},
+	} {
+		t.Run(c.what, func(t *testing.T) {
+			srv := httptest.NewServer(c.handler)
+			defer srv.Close()
+
+			f, err := NewHTTPFile(srv.URL, HTTPOptions{BlockSize: 64})
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			if f.Size() != 0 {
+				t.Errorf("expected size 0, got %d", f.Size())
+			}
+			if n, err := f.ReadAt(make([]byte, 10), 0); n != 0 || err != io.EOF {
+				t.Errorf("expected io.EOF, got %d %v", n, err)
+			}
+			if _, err := Open(f, f.Size()); err == nil {
+				t.Errorf("expected error opening empty dict")
+			}
+		})
+	}
+}
+
+func TestHTTPFileTruncated(t *testing.T) {
+	content := testHTTPContent(1000)
+	s := &testHTTPServer{}
+	s.set(content, "")
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	f, err := NewHTTPFile(srv.URL, HTTPOptions{BlockSize: 64})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	// without a validator, the server will respond with 416 for ranges
+	// after the new end of the file
+	s.set(content[:500], "")
+	if _, err := f.ReadAt(make([]byte, 10), 800); err == nil || !strings.Contains(err.Error(), "416") {
+		t.Errorf("expected 416 error, got %v", err)
+	}
+
+	// and the size will not match for ones before it
+	if _, err := f.ReadAt(make([]byte, 10), 200); !errors.Is(err, errRemoteChanged) {
+		t.Errorf("expected changed error, got %v", err)
+	}
+}
+
+func TestHTTPFileShortBody(t *testing.T) {
+	content := testHTTPContent(1000)
+	var short bool
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		s := short
+		mu.Unlock()
+		if !s {
+			http.ServeContent(w, r, "dict", time.Time{}, bytes.NewReader(content))
+			return
+		}
+		var start, end int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start : start+(end-start)/2]) // less than the range
+	}))
+	defer srv.Close()
+
+	f, err := NewHTTPFile(srv.URL, HTTPOptions{BlockSize: 64})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	mu.Lock()
+	short = true
+	mu.Unlock()
+
+	if _, err := f.ReadAt(make([]byte, 100), 200); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+
+	// the failed blocks shouldn't be cached
+	mu.Lock()
+	short = false
+	mu.Unlock()
+
+	p := make([]byte, 100)
+	if _, err := f.ReadAt(p, 200); err != nil {
+		t.Errorf("read after error: %v", err)
+	} else if !bytes.Equal(p, content[200:300]) {
+		t.Errorf("read after error: incorrect data")
+	}
+}
+
+func TestHTTPFileChanged(t *testing.T) {
+	content := testHTTPContent(1000)
+	s := &testHTTPServer{}
+	s.set(content, `"v1"`)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	f, err := NewHTTPFile(srv.URL, HTTPOptions{BlockSize: 64})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := f.ReadAt(make([]byte, 10), 100); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	// the same size, but a different ETag, so If-Range will return the whole
+	// file
+	s.set(append([]byte{}, content...), `"v2"`)
+	if _, err := f.ReadAt(make([]byte, 10), 500); !errors.Is(err, errRemoteChanged) {
+		t.Errorf("expected changed error, got %v", err)
+	}
+
+	// cached blocks can still be read
+	if _, err := f.ReadAt(make([]byte, 10), 100); err != nil {
+		t.Errorf("read cached: %v", err)
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dictserver")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := WordMap{}
+	for _, w := range testWriterWords() {
+		for _, hw := range w.headwords {
+			wm[hw] = append(wm[hw], w.word)
+		}
+	}
+	fn := filepath.Join(dir, "test.dict")
+	if err := CreateFile(wm, fn); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	s := &testHTTPServer{}
+	s.set(buf, `"v1"`)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	d, err := OpenURL(srv.URL, HTTPOptions{BlockSize: 128})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer d.Close()
+
+	for hw, exp := range wm {
+		ws, ok, err := d.GetWords(hw)
+		if err != nil || !ok {
+			t.Errorf("get %s: %v %v", hw, ok, err)
+		} else if len(ws) != len(exp) {
+			t.Errorf("get %s: expected %d words, got %d", hw, len(exp), len(ws))
+		}
+	}
+	if err := d.Verify(); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package dictionary
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Inflection is an inflected form of a word.
+type Inflection struct {
+	Form string   `json:"form" diskstore:"f"`
+	Tags []string `json:"tags" diskstore:"t"` // e.g. "past", "past participle", "plural"
+}
+
+// Stress levels for Word.Stress.
+const (
+	StressNone      = 0
+	StressPrimary   = 1
+	StressSecondary = 2
+)
+
+// HasPOS checks if the word has a part of speech. The last word of the part of
+// speech also matches, so "verb" matches "transitive verb".
+func (w *Word) HasPOS(pos string) bool {
+	pos = strings.ToLower(strings.TrimSpace(pos))
+	for _, p := range w.PartsOfSpeech {
+		if p == pos || strings.HasSuffix(p, " "+pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// infoAbbr maps an abbreviation used in the info to its meaning.
+type infoAbbr struct {
+	abbr string
+	tags []string
+}
+
+// infoPOS are the abbreviations for parts of speech. Longer abbreviations
+// which start with shorter ones must come first.
+var infoPOS = []infoAbbr{
+	{"n. pl.", []string{"plural noun"}},
+	{"n. sing.", []string{"singular noun"}},
+	{"n.", []string{"noun"}},
+	{"v. t. & i.", []string{"transitive verb", "intransitive verb"}},
+	{"v. t.", []string{"transitive verb"}},
+	{"v. i.", []string{"intransitive verb"}},
+	{"v.", []string{"verb"}},
+	{"a.", []string{"adjective"}},
+	{"adj.", []string{"adjective"}},
+	{"adv.", []string{"adverb"}},
+	{"pron.", []string{"pronoun"}},
+	{"conj.", []string{"conjunction"}},
+	{"prep.", []string{"preposition"}},
+	{"interj.", []string{"interjection"}},
+	{"p. p.", []string{"past participle"}},
+	{"p. pr.", []string{"present participle"}},
+	{"p. a.", []string{"participial adjective"}},
+	{"imp.", []string{"past"}},
+	{"art.", []string{"article"}},
+	{"pl.", []string{"plural"}},
+	{"vb. n.", []string{"verbal noun"}},
+}
+
+// infoInfl are the abbreviations for inflections.
+var infoInfl = []infoAbbr{
+	{"imp.", []string{"past"}},
+	{"p. p.", []string{"past participle"}},
+	{"p. pr.", []string{"present participle"}},
+	{"vb. n.", []string{"verbal noun"}},
+	{"pl.", []string{"plural"}},
+	{"superl.", []string{"superlative"}},
+	{"compar.", []string{"comparative"}},
+	{"3d pers. sing. pres.", []string{"third-person singular present"}},
+	{"2d pers. sing. pres.", []string{"second-person singular present"}},
+	{"pres.", []string{"present"}},
+	{"sing.", []string{"singular"}},
+	{"fem.", []string{"feminine"}},
+}
+
+// parseInfo parses the parts of speech, syllables, stress, and inflections
+// from the info of a word, which looks like:
+//
+//   Ex*am"ple, v. t. [imp. & p. p. Exampled; p. pr. & vb. n. Exampling.]
+//
+// The headword is split into syllables by *, ", and `, where the latter two
+// also mark the preceding syllable as having primary or secondary stress. It
+// is followed by the parts of speech, then optionally the inflected forms in
+// square brackets. Anything which can't be parsed is ignored.
+func parseInfo(w *Word) {
+	info := strings.TrimSpace(w.Info)
+
+	var infl string
+	if i := strings.IndexByte(info, '['); i != -1 {
+		if j := strings.IndexByte(info[i:], ']'); j != -1 {
+			info, infl = strings.TrimSpace(info[:i]), info[i+1:i+j]
+		}
+	}
+
+	// the headword, then any alternate headwords or parts of speech
+	parts := strings.Split(info, ", ")
+	w.Syllables, w.Stress = parseSyllables(parts[0], w.Word)
+	for _, p := range parts[1:] {
+		if tags, rest := parseAbbrs(p, infoPOS); len(tags) != 0 && strings.TrimSpace(rest) == "" {
+			w.PartsOfSpeech = appendUnique(w.PartsOfSpeech, tags...)
+		}
+	}
+
+	// e.g. imp. & p. p. Exampled; p. pr. & vb. n. Exampling.
+	for _, p := range strings.Split(infl, ";") {
+		tags, rest := parseAbbrs(p, infoInfl)
+		if len(tags) == 0 {
+			continue
+		}
+		rest = strings.TrimSuffix(strings.TrimSpace(rest), ".")
+		for _, f := range strings.FieldsFunc(strings.ReplaceAll(rest, " or ", ","), func(r rune) bool {
+			return r == ','
+		}) {
+			f = strings.ToLower(strings.Map(func(r rune) rune {
+				if r == '*' || r == '"' || r == '`' {
+					return -1
+				}
+				return r
+			}, strings.TrimSpace(f)))
+			if f != "" {
+				w.Inflections = append(w.Inflections, Inflection{f, tags})
+			}
+		}
+	}
+}
+
+// parseSyllables splits a marked headword into syllables and their stress. If
+// it does not have any marks, or it doesn't match the headword, nil is
+// returned.
+func parseSyllables(s, headword string) ([]string, []int) {
+	if !strings.ContainsAny(s, "*\"`") {
+		return nil, nil
+	}
+
+	var syls []string
+	var stress []int
+	var cur strings.Builder
+	for _, r := range s {
+		var st int
+		switch r {
+		case '*':
+			st = StressNone
+		case '"':
+			st = StressPrimary
+		case '`':
+			st = StressSecondary
+		default:
+			cur.WriteRune(r)
+			continue
+		}
+		if cur.Len() == 0 {
+			return nil, nil
+		}
+		syls, stress = append(syls, strings.ToLower(cur.String())), append(stress, st)
+		cur.Reset()
+	}
+	if cur.Len() != 0 {
+		syls, stress = append(syls, strings.ToLower(cur.String())), append(stress, StressNone)
+	}
+
+	if completeKey(strings.Join(syls, "")) != completeKey(headword) {
+		return nil, nil
+	}
+	return syls, stress
+}
+
+// parseAbbrs parses a list of abbreviations separated by "&" or "," from the
+// start of s, returning their tags and the rest of s.
+func parseAbbrs(s string, abbrs []infoAbbr) ([]string, string) {
+	var tags []string
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		var found bool
+		for _, a := range abbrs {
+			if strings.HasPrefix(s, a.abbr) {
+				if r := s[len(a.abbr):]; r == "" || r[0] == ' ' || r[0] == ',' || r[0] == '&' {
+					tags, s, found = appendUnique(tags, a.tags...), r, true
+					break
+				}
+			}
+		}
+		if !found {
+			return tags, s
+		}
+		if r := strings.TrimLeftFunc(s, unicode.IsSpace); strings.HasPrefix(r, "&") || strings.HasPrefix(r, ",") {
+			s = r[1:]
+		}
+	}
+}
+
+func appendUnique(s []string, v ...string) []string {
+add:
+	for _, x := range v {
+		for _, y := range s {
+			if x == y {
+				continue add
+			}
+		}
+		s = append(s, x)
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package dictionary
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInfo(t *testing.T) {
+	for _, c := range []struct {
+		word, info string
+		exp        Word
+	}{
+		{"example", `Ex*am"ple, n.`, Word{
+			PartsOfSpeech: []string{"noun"},
+			Syllables:     []string{"ex", "am", "ple"},
+			Stress:        []int{StressNone, StressPrimary, StressNone},
+		}},
+		{"arch", ` Arch, v. t. [imp. & p. p. Arched; p. pr. & vb. n. Arching.]`, Word{
+			PartsOfSpeech: []string{"transitive verb"},
+			Inflections: []Inflection{
+				{"arched", []string{"past", "past participle"}},
+				{"arching", []string{"present participle", "verbal noun"}},
+			},
+		}},
+		{"run", `Run, v. i. [imp. Ran or Run; p. p. Run; p. pr. & vb. n. Running.]`, Word{
+			PartsOfSpeech: []string{"intransitive verb"},
+			Inflections: []Inflection{
+				{"ran", []string{"past"}},
+				{"run", []string{"past"}},
+				{"run", []string{"past participle"}},
+				{"running", []string{"present participle", "verbal noun"}},
+			},
+		}},
+		{"colour", `Col"or, n.`, Word{PartsOfSpeech: []string{"noun"}}}, // the syllables don't match the headword
+		{"cafe", "Ca`fé\", n.", Word{
+			PartsOfSpeech: []string{"noun"},
+			Syllables:     []string{"ca", "fé"},
+			Stress:        []int{StressSecondary, StressPrimary},
+		}},
+		{"arc", `Arc, n. [F. arc, fr. L. arcus.]`, Word{PartsOfSpeech: []string{"noun"}}}, // not inflections
+		{"a", ` A (named a in the English).`, Word{}},                                     // no parts of speech
+		{"act", `Act, v. t. & i.`, Word{PartsOfSpeech: []string{"transitive verb", "intransitive verb"}}},
+	} {
+		w := Word{Word: c.word, Info: c.info}
+		parseInfo(&w)
+		c.exp.Word, c.exp.Info = c.word, c.info
+		if !reflect.DeepEqual(w, c.exp) {
+			t.Errorf("parse %q:\nexpected %+v\ngot      %+v", c.info, c.exp, w)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package dictionary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Iterator is implemented by Stores which can list their headwords. It is
+// implemented by File, WordMap, MultiStore (if all of the underlying Stores
+// implement it), and OverlayStore (if the base Store implements it).
+type Iterator interface {
+	// Headwords returns an iterator over the headwords which are greater than
+	// or equal to start and have the specified prefix, in sorted order (by
+	// byte). Both may be empty.
+	Headwords(start, prefix string) HeadwordIterator
+}
+
+// HeadwordIterator iterates over the headwords in a Store. Next must be called
+// before the first headword. It is not safe for concurrent use.
+type HeadwordIterator interface {
+	// Next advances to the next headword. It returns false at the end or on
+	// error.
+	Next() bool
+	// Headword returns the current headword.
+	Headword() string
+	// Words gets the entries for the current headword, as returned by
+	// GetWords. They are not read until it is called.
+	Words() ([]*Word, error)
+	// Err returns the error which stopped the iteration, if any.
+	Err() error
+}
+
+// Headwords returns an iterator over the headwords in a Store, or an error if
+// it does not implement Iterator.
+func Headwords(store Store, start, prefix string) (HeadwordIterator, error) {
+	if it, ok := store.(Iterator); ok {
+		return it.Headwords(start, prefix), nil
+	}
+	return nil, fmt.Errorf("store %T does not support iteration", store)
+}
+
+// sliceIterator iterates over a sorted slice of headwords.
+type sliceIterator struct {
+	hws   []string
+	i     int
+	words func(headword string) ([]*Word, error)
+}
+
+// newSliceIterator creates an iterator over the headwords from the sorted
+// slice hws which are greater than or equal to start and have the prefix.
+func newSliceIterator(hws []string, start, prefix string, words func(headword string) ([]*Word, error)) *sliceIterator {
+	if start < prefix {
+		start = prefix
+	}
+	hws = hws[sort.SearchStrings(hws, start):]
+	hws = hws[:sort.Search(len(hws), func(i int) bool {
+		return !strings.HasPrefix(hws[i], prefix)
+	})]
+	return &sliceIterator{hws, -1, words}
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.i+1 >= len(it.hws) {
+		it.i = len(it.hws)
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *sliceIterator) Headword() string {
+	return it.hws[it.i]
+}
+
+func (it *sliceIterator) Words() ([]*Word, error) {
+	return it.words(it.hws[it.i])
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+// mergeIterator merges the headwords from multiple iterators, removing
+// duplicates.
+type mergeIterator struct {
+	its   []HeadwordIterator
+	ok    []bool // whether each iterator has a current headword
+	hw    string
+	init  bool
+	err   error
+	words func(headword string) ([]*Word, error)
+}
+
+func newMergeIterator(its []HeadwordIterator, words func(headword string) ([]*Word, error)) *mergeIterator {
+	return &mergeIterator{its: its, ok: make([]bool, len(its)), words: words}
+}
+
+func (it *mergeIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	// advance the iterators which were at the current headword
+	for i, x := range it.its {
+		if !it.init || (it.ok[i] && x.Headword() == it.hw) {
+			if it.ok[i] = x.Next(); !it.ok[i] {
+				if err := x.Err(); err != nil {
+					it.err = err
+					return false
+				}
+			}
+		}
+	}
+	it.init = true
+
+	// find the smallest headword
+	var found bool
+	for i, x := range it.its {
+		if it.ok[i] {
+			if hw := x.Headword(); !found || hw < it.hw {
+				it.hw, found = hw, true
+			}
+		}
+	}
+	return found
+}
+
+func (it *mergeIterator) Headword() string {
+	return it.hw
+}
+
+func (it *mergeIterator) Words() ([]*Word, error) {
+	return it.words(it.hw)
+}
+
+func (it *mergeIterator) Err() error {
+	return it.err
+}
+
+// errIterator is an empty iterator which returns an error.
+type errIterator struct {
+	err error
+}
+
+func (it errIterator) Next() bool {
+	return false
+}
+
+func (it errIterator) Headword() string {
+	return ""
+}
+
+func (it errIterator) Words() ([]*Word, error) {
+	return nil, it.err
+}
+
+func (it errIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,323 @@
+package dictionary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// keyTableBlock is the number of keys in each block of a key table. Larger
+// blocks compress better, but make lookups slower.
+const keyTableBlock = 16
+
+// keyTable is a read-only sorted map of string keys to lists of unsigned
+// integers, which can be searched directly from its encoded form.
+//
+// It is encoded as follows:
+//
+//   + ----- + ------- + ----------------------- + --------------------------------------------------------------- +
+//   |       |         |  + ------------ +       |  + ---------------------------------------------------------- +       |
+//   |  len  |  nblks  |  | block offset | ...   |  | shared | suffix len | suffix | nvals | val | ... | ...     | ...   |
+//   |       |         |  + ============ +       |  + ========================================================== +       |
+//   + ----- + ------- + ----------------------- + --------------------------------------------------------------- +
+//
+//   The len, nblks and block offsets are little-endian int64. The block offsets
+//   are relative to the start of the first block. Everything inside a block is
+//   a uvarint.
+//
+// Each block contains up to keyTableBlock keys. The first key of each block is
+// stored in full (i.e. shared is 0), and the rest only store the suffix after
+// the prefix shared with the previous key. To find a key, the block is found
+// using a binary search over the first keys, and then the block is scanned.
+type keyTable struct {
+	n    int
+	blks []byte // nblks * sizew
+	data []byte
+}
+
+// parseKeyTable parses the header of an encoded key table. It does not copy b.
+func parseKeyTable(b []byte) (*keyTable, error) {
+	if int64(len(b)) < sizew*2 {
+		return nil, fmt.Errorf("key table too short")
+	}
+	n := int64(binary.LittleEndian.Uint64(b))
+	nblks := int64(binary.LittleEndian.Uint64(b[sizew:]))
+	if n < 0 || nblks < 0 || nblks > int64(len(b))/sizew || n > nblks*keyTableBlock {
+		return nil, fmt.Errorf("invalid key table header (len=%d, nblks=%d)", n, nblks)
+	} else if (n+keyTableBlock-1)/keyTableBlock != nblks {
+		return nil, fmt.Errorf("invalid key table header (len=%d, nblks=%d)", n, nblks)
+	}
+	if int64(len(b)) < sizew*2+nblks*sizew {
+		return nil, fmt.Errorf("key table too short for %d blocks", nblks)
+	}
+	return &keyTable{
+		n:    int(n),
+		blks: b[sizew*2 : sizew*2+nblks*sizew],
+		data: b[sizew*2+nblks*sizew:],
+	}, nil
+}
+
+// Len returns the number of keys in the table.
+func (t *keyTable) Len() int {
+	return t.n
+}
+
+// Get gets the values for a key.
+func (t *keyTable) Get(key string) ([]uint64, bool, error) {
+	it := t.Seek(key)
+	if !it.Next() {
+		return nil, false, it.Err()
+	}
+	if it.Key() != key {
+		return nil, false, nil
+	}
+	return it.Values(), true, nil
+}
+
+// Seek returns an iterator positioned before the first key greater than or
+// equal to key.
+func (t *keyTable) Seek(key string) *keyTableIter {
+	nblks := len(t.blks) / int(sizew)
+
+	// find the first block with a first key greater than key
+	var err error
+	blk := sort.Search(nblks, func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var k []byte
+		if k, err = t.firstKey(i); err != nil {
+			return true
+		}
+		return string(k) > key
+	})
+	if err != nil {
+		return &keyTableIter{t: t, err: err}
+	}
+
+	// the key will be in the previous one if it exists
+	if blk != 0 {
+		blk--
+	}
+
+	// skip to the key
+	it := &keyTableIter{t: t, blk: blk, off: -1}
+	for it.peek() {
+		if string(it.next) >= key {
+			break
+		}
+		it.advance()
+	}
+	return it
+}
+
+// blockOffset gets the offset of the start of a block in the data.
+func (t *keyTable) blockOffset(i int) (int, error) {
+	off := int64(binary.LittleEndian.Uint64(t.blks[int64(i)*sizew:]))
+	if off < 0 || off >= int64(len(t.data)) {
+		return 0, fmt.Errorf("key table block %d offset %d out of range", i, off)
+	}
+	return int(off), nil
+}
+
+// firstKey reads the first key of a block.
+func (t *keyTable) firstKey(i int) ([]byte, error) {
+	off, err := t.blockOffset(i)
+	if err != nil {
+		return nil, err
+	}
+	r := keyTableReader{b: t.data, off: off}
+	if shared := r.uvarint(); shared != 0 && r.err == nil {
+		return nil, fmt.Errorf("key table block %d: first key is prefix-compressed", i)
+	}
+	k := r.bytes(r.uvarint())
+	return k, r.err
+}
+
+// keyTableIter iterates over a keyTable in sorted order. It is not safe for
+// concurrent use.
+type keyTableIter struct {
+	t    *keyTable
+	blk  int // current block
+	idx  int // index of the next key in the block
+	off  int // offset of the next key in the data, or -1 to start at blk
+	key  []byte
+	vals []uint64
+	err  error
+
+	next    []byte   // the next key, if peeked
+	nextv   []uint64 // the next values, if peeked
+	nextoff int      // the offset after the next key, if peeked
+	peeked  bool
+}
+
+// Next advances to the next key. It returns false at the end of the table or on
+// error.
+func (it *keyTableIter) Next() bool {
+	if !it.peek() {
+		return false
+	}
+	it.advance()
+	return true
+}
+
+// Key returns the current key.
+func (it *keyTableIter) Key() string {
+	return string(it.key)
+}
+
+// Values returns the values for the current key.
+func (it *keyTableIter) Values() []uint64 {
+	return it.vals
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *keyTableIter) Err() error {
+	return it.err
+}
+
+// peek decodes the next key without advancing to it.
+func (it *keyTableIter) peek() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.peeked {
+		return true
+	}
+
+	prev := it.key
+	nblks := len(it.t.blks) / int(sizew)
+	if it.off == -1 || it.idx == keyTableBlock {
+		if it.off != -1 {
+			it.blk++
+		}
+		if it.blk >= nblks {
+			return false
+		}
+		off, err := it.t.blockOffset(it.blk)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.off, it.idx, prev = off, 0, nil
+	}
+	if it.blk*keyTableBlock+it.idx >= it.t.n {
+		return false
+	}
+
+	r := keyTableReader{b: it.t.data, off: it.off}
+	shared := r.uvarint()
+	suffix := r.bytes(r.uvarint())
+	if r.err == nil && shared > uint64(len(prev)) {
+		r.err = fmt.Errorf("invalid shared prefix length %d", shared)
+	}
+	nvals := r.uvarint()
+	if r.err == nil && nvals > uint64(len(r.b)-r.off) {
+		r.err = fmt.Errorf("invalid value count %d", nvals)
+	}
+	var vals []uint64
+	if r.err == nil {
+		vals = make([]uint64, nvals)
+		for i := range vals {
+			vals[i] = r.uvarint()
+		}
+	}
+	if r.err != nil {
+		it.err = fmt.Errorf("key table block %d key %d: %v", it.blk, it.idx, r.err)
+		return false
+	}
+
+	key := make([]byte, 0, int(shared)+len(suffix))
+	key = append(key, prev[:shared]...)
+	key = append(key, suffix...)
+	if prev != nil && bytes.Compare(key, prev) <= 0 {
+		it.err = fmt.Errorf("key table block %d key %d: keys out of order", it.blk, it.idx)
+		return false
+	}
+
+	it.next, it.nextv, it.nextoff, it.peeked = key, vals, r.off, true
+	return true
+}
+
+// advance moves to the peeked key.
+func (it *keyTableIter) advance() {
+	it.key, it.vals, it.off = it.next, it.nextv, it.nextoff
+	it.next, it.nextv, it.peeked = nil, nil, false
+	it.idx++
+}
+
+// keyTableReader reads uvarints and byte strings from a key table block. After
+// the first error, it returns zero values.
+type keyTableReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *keyTableReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b[r.off:])
+	if n <= 0 {
+		r.err = fmt.Errorf("invalid uvarint at %d", r.off)
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+func (r *keyTableReader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.b)-r.off) {
+		r.err = fmt.Errorf("string length %d at %d out of range", n, r.off)
+		return nil
+	}
+	b := r.b[r.off : r.off+int(n)]
+	r.off += int(n)
+	return b
+}
+
+// encodeKeyTable encodes a map into a key table.
+func encodeKeyTable(m map[string][]uint64) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	nblks := (len(keys) + keyTableBlock - 1) / keyTableBlock
+	hdr := make([]byte, sizew*2+int64(nblks)*sizew)
+	binary.LittleEndian.PutUint64(hdr, uint64(len(keys)))
+	binary.LittleEndian.PutUint64(hdr[sizew:], uint64(nblks))
+
+	var data []byte
+	var prev string
+	var tmp [binary.MaxVarintLen64]byte
+	uvarint := func(v uint64) {
+		data = append(data, tmp[:binary.PutUvarint(tmp[:], v)]...)
+	}
+	for i, k := range keys {
+		var shared int
+		if i%keyTableBlock == 0 {
+			binary.LittleEndian.PutUint64(hdr[sizew*2+int64(i/keyTableBlock)*sizew:], uint64(len(data)))
+		} else {
+			for shared < len(prev) && shared < len(k) && prev[shared] == k[shared] {
+				shared++
+			}
+		}
+		uvarint(uint64(shared))
+		uvarint(uint64(len(k) - shared))
+		data = append(data, k[shared:]...)
+		uvarint(uint64(len(m[k])))
+		for _, v := range m[k] {
+			uvarint(v)
+		}
+		prev = k
+	}
+
+	return append(hdr, data...)
+}
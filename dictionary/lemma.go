@@ -0,0 +1,137 @@
+package dictionary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lemma is an entry which lists a word as one of its inflected forms (see
+// Word.Inflections).
+type Lemma struct {
+	Headword   string   `json:"headword"`   // of the entry
+	Inflection string   `json:"inflection"` // the inflected form
+	Tags       []string `json:"tags"`       // of the inflection
+}
+
+// Lemmatizer is implemented by Stores which can find entries by their inflected
+// forms.
+// It is implemented by File (if it was created with entries which have
+// inflections), WordMap, MultiStore, and OverlayStore.
+type Lemmatizer interface {
+	// Lemmas returns the entries which list form as an inflected form. The
+	// form must be normalized in the same way as a headword.
+	Lemmas(form string) ([]Lemma, error)
+}
+
+// Lemmas returns the entries in a Store which list form as an inflected form.
+// If it does not implement Lemmatizer, nothing is returned.
+func Lemmas(store Store, form string) ([]Lemma, error) {
+	if l, ok := store.(Lemmatizer); ok {
+		return l.Lemmas(form)
+	}
+	return nil, nil
+}
+
+// Lemmas implements Lemmatizer using the inflection index (INFL), if present.
+func (d *File) Lemmas(form string) ([]Lemma, error) {
+	if d.infl == nil {
+		return nil, nil
+	}
+	cur, ok, err := d.infl.Get(form)
+	if err != nil {
+		return nil, formatErr("inflection index", -1, ErrMalformed, err)
+	} else if !ok {
+		return nil, nil
+	}
+	var ls []Lemma
+	for _, c := range cur {
+		w, err := d.get(c)
+		if err != nil {
+			return nil, fmt.Errorf("get lemma %d: %w", c, err)
+		}
+		ls = appendLemmas(ls, w, form)
+	}
+	return ls, nil
+}
+
+// Lemmas implements Lemmatizer by checking the inflections of every entry, in
+// order of their headword. Since a WordMap does not have an index, this is slow
+// for large ones, so a File should be used instead if possible.
+func (wm WordMap) Lemmas(form string) ([]Lemma, error) {
+	var ls []Lemma
+	seen := map[*Word]bool{}
+	for _, ws := range wm {
+		for _, w := range ws {
+			if !seen[w] {
+				seen[w] = true
+				ls = appendLemmas(ls, w, form)
+			}
+		}
+	}
+	sort.Slice(ls, func(i, j int) bool {
+		if ls[i].Headword != ls[j].Headword {
+			return ls[i].Headword < ls[j].Headword
+		}
+		return strings.Join(ls[i].Tags, ",") < strings.Join(ls[j].Tags, ",")
+	})
+	return ls, nil
+}
+
+// Lemmas implements Lemmatizer by concatenating the lemmas from each Store in
+// order of priority.
+func (ms *MultiStore) Lemmas(form string) ([]Lemma, error) {
+	var ls []Lemma
+	for i, s := range ms.stores {
+		x, err := Lemmas(s, form)
+		if err != nil {
+			return nil, fmt.Errorf("store %d: %w", i, err)
+		}
+		prev := ls // only skip headwords from higher-priority stores
+	add:
+		for _, l := range x {
+			for _, y := range prev {
+				if y.Headword == l.Headword {
+					continue add
+				}
+			}
+			ls = append(ls, l)
+		}
+	}
+	return ls, nil
+}
+
+// Lemmas implements Lemmatizer by combining the lemmas from the base Store
+// (other than ones replaced or hidden by the overlay) with the ones from the
+// entries in the overlay.
+func (s *OverlayStore) Lemmas(form string) ([]Lemma, error) {
+	x, err := Lemmas(s.base, form)
+	if err != nil {
+		return nil, err
+	}
+	var ls []Lemma
+	for _, l := range x {
+		if e, ok := s.ov.Get(l.Headword); !ok || e.Action == OverlayAdd {
+			ls = append(ls, l)
+		}
+	}
+
+	s.ov.mu.RLock()
+	defer s.ov.mu.RUnlock()
+	for _, hw := range s.ov.infl[form] {
+		for _, w := range s.ov.entries[hw].Words {
+			ls = appendLemmas(ls, w, form)
+		}
+	}
+	return ls, nil
+}
+
+// appendLemmas appends the inflections of w matching form.
+func appendLemmas(ls []Lemma, w *Word, form string) []Lemma {
+	for _, f := range w.Inflections {
+		if f.Form == form {
+			ls = append(ls, Lemma{w.Word, f.Form, cloneStrings(f.Tags)})
+		}
+	}
+	return ls
+}
@@ -0,0 +1,114 @@
+package dictionary
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLemmas(t *testing.T) {
+	wm, err := Parse(strings.NewReader(testLemmaDict))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "dictserver")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "test.dict")
+	if err := CreateFile(wm, fn); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	d, err := OpenFile(fn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer d.Close()
+
+	ov, err := OpenOverlay(filepath.Join(dir, "overlay.json"))
+	if err != nil {
+		t.Fatalf("open overlay: %v", err)
+	}
+	ovs := NewOverlayStore(d, ov)
+
+	for _, c := range []struct {
+		form string
+		exp  []Lemma
+	}{
+		{"ran", []Lemma{{"run", "ran", []string{"past"}}}},
+		{"run", []Lemma{{"run", "run", []string{"past"}}, {"run", "run", []string{"past participle"}}}},
+		{"arching", []Lemma{{"arch", "arching", []string{"present participle", "verbal noun"}}}},
+		{"arch", nil},
+		{"nonexistent", nil},
+	} {
+		for _, s := range []struct {
+			what  string
+			store Store
+		}{
+			{"WordMap", wm},
+			{"File", d},
+			{"MultiStore", NewMultiStore(DedupeExact, d, wm)},
+			{"OverlayStore", ovs},
+		} {
+			if ls, err := Lemmas(s.store, c.form); err != nil {
+				t.Errorf("%s: lemmas %q: %v", s.what, c.form, err)
+			} else if !reflect.DeepEqual(ls, c.exp) {
+				t.Errorf("%s: lemmas %q: expected %+v, got %+v", s.what, c.form, c.exp, ls)
+			}
+		}
+	}
+
+	// lookups use the inflections without needing a File
+	if _, res, ok, err := LookupWordResult(wm, "Ran"); err != nil || !ok {
+		t.Errorf("lookup: %v %v", ok, err)
+	} else if res.Key != "run" || res.Lemma == nil || res.Lemma.Inflection != "ran" {
+		t.Errorf("lookup: expected run from ran, got %+v", res)
+	}
+
+	// overlay entries are included unless hidden, and ones for hidden or
+	// replaced headwords from the base Store aren't
+	if err := ov.Add("go", &Word{Word: "go", Inflections: []Inflection{{"went", []string{"past"}}, {"ran", []string{"slang"}}}}); err != nil {
+		t.Fatalf("overlay add: %v", err)
+	}
+	if ls, _ := Lemmas(ovs, "ran"); !reflect.DeepEqual(ls, []Lemma{{"run", "ran", []string{"past"}}, {"go", "ran", []string{"slang"}}}) {
+		t.Errorf("overlay: unexpected lemmas %+v", ls)
+	}
+	if err := ov.Hide("run"); err != nil {
+		t.Fatalf("overlay hide: %v", err)
+	}
+	if ls, _ := Lemmas(ovs, "ran"); !reflect.DeepEqual(ls, []Lemma{{"go", "ran", []string{"slang"}}}) {
+		t.Errorf("overlay: unexpected lemmas %+v", ls)
+	}
+	if err := ov.Hide("go"); err != nil {
+		t.Fatalf("overlay hide: %v", err)
+	}
+	if ls, _ := Lemmas(ovs, "went"); len(ls) != 0 {
+		t.Errorf("overlay: unexpected lemmas %+v", ls)
+	}
+}
+
+const testLemmaDict = `*** START OF THIS PROJECT GUTENBERG EBOOK WEBSTER'S UNABRIDGED DICTIONARY ***
+
+A
+A (named a in the English).
+
+Defn: The first letter of the English alphabet.
+
+ARCH
+Arch, v. t. [imp. & p. p. Arched; p. pr. & vb. n. Arching.]
+
+Defn: To cover with an arch or arches.
+
+RUN
+Run, v. i. [imp. Ran or Run; p. p. Run; p. pr. & vb. n. Running.]
+
+Defn: To move by quick steps.
+
+*** END OF THIS PROJECT GUTENBERG EBOOK WEBSTER'S UNABRIDGED DICTIONARY ***
+`
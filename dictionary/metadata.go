@@ -0,0 +1,131 @@
+package dictionary
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Metadata describes a dictionary as a whole. It is stored in the META section
+// of a dict file.
+type Metadata struct {
+	Title          string    `json:"title,omitempty" diskstore:"t"`
+	Description    string    `json:"description,omitempty" diskstore:"d"`
+	Language       string    `json:"language,omitempty" diskstore:"l"`
+	License        string    `json:"license,omitempty" diskstore:"c"`
+	SourceURL      string    `json:"source_url,omitempty" diskstore:"u"`
+	BuildTime      time.Time `json:"build_time" diskstore:"b"` // zero if unknown
+	BuilderVersion string    `json:"builder_version,omitempty" diskstore:"v"`
+	Headwords      int       `json:"headwords" diskstore:"h"` // set by Writer
+	Entries        int       `json:"entries" diskstore:"e"`   // set by Writer
+}
+
+// MetadataGetter is implemented by Stores which have Metadata.
+type MetadataGetter interface {
+	// Metadata returns a copy of the metadata, or nil if there isn't any.
+	Metadata() *Metadata
+}
+
+// ParseMetadata parses the Project Gutenberg header from the beginning of the
+// Webster's Unabridged Dictionary of 1913 (or data/about.txt). It stops at the
+// "*** START OF" line or the end of the input. Fields which can't be found are
+// left empty, and if there isn't a header, the Metadata will be empty.
+func ParseMetadata(r io.Reader) (*Metadata, error) {
+	var m Metadata
+	var para []string
+	var paras [][]string
+	var header bool
+
+	fieldRe := regexp.MustCompile(`^([A-Z][A-Za-z ]+):\s*(.*)$`)
+	ebookRe := regexp.MustCompile(`\[EBook #([0-9]+)\]`)
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "*** START OF") {
+			header = true
+			break
+		}
+		if line == "" {
+			if len(para) != 0 {
+				paras = append(paras, para)
+				para = nil
+			}
+			continue
+		}
+		para = append(para, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read header: %v", err)
+	}
+	if len(para) != 0 {
+		paras = append(paras, para)
+	}
+
+	// the header is a description, a license, then the fields
+	for i, p := range paras {
+		if fieldRe.MatchString(p[0]) {
+			for _, line := range p {
+				if x := fieldRe.FindStringSubmatch(line); x != nil {
+					switch x[1] {
+					case "Title":
+						m.Title, header = x[2], true
+					case "Language":
+						m.Language = x[2]
+					case "Release Date":
+						if e := ebookRe.FindStringSubmatch(x[2]); e != nil {
+							m.SourceURL = "https://www.gutenberg.org/ebooks/" + e[1]
+						}
+					}
+				}
+			}
+			continue
+		}
+		switch i {
+		case 0:
+			m.Description = strings.Join(p, " ")
+		case 1:
+			m.License = strings.Join(p, " ")
+		}
+	}
+
+	if !header {
+		return &Metadata{}, nil // the paragraphs are something else
+	}
+	return &m, nil
+}
+
+// clone returns a copy of the metadata.
+func (m *Metadata) clone() *Metadata {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	return &c
+}
+
+func encodeMetadata(m *Metadata) ([]byte, error) {
+	var buf bytes.Buffer
+	e := msgpack.NewEncoder(&buf)
+	e.SetCustomStructTag("diskstore")
+	if err := e.Encode(m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeMetadata(b []byte) (*Metadata, error) {
+	var m Metadata
+	c := msgpack.NewDecoder(bytes.NewReader(b))
+	c.SetCustomStructTag("diskstore")
+	if err := c.Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
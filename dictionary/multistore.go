@@ -0,0 +1,140 @@
+package dictionary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// MultiStore combines an ordered list of Stores into a single Store. Entries
+// from earlier Stores have priority over later ones. It is safe for concurrent
+// use if the underlying Stores are.
+type MultiStore struct {
+	stores []Store
+	dedupe DedupeFunc
+}
+
+// DedupeFunc checks whether the entry b should be hidden since it is a duplicate
+// of a, which is from a Store with a higher priority. Entries are only compared
+// if they are returned for the same headword.
+type DedupeFunc func(a, b *Word) bool
+
+// DedupeNone does not hide any entries.
+func DedupeNone(a, b *Word) bool {
+	return false
+}
+
+// DedupeExact hides entries which are exactly the same, other than the credit.
+func DedupeExact(a, b *Word) bool {
+	x, y := *a, *b
+	x.Credit, y.Credit = "", ""
+	return reflect.DeepEqual(x, y)
+}
+
+// DedupeInfo hides entries with the same headword and info (i.e. the same
+// headword and part of speech), even if the definitions are different.
+func DedupeInfo(a, b *Word) bool {
+	return a.Word == b.Word && a.Info == b.Info
+}
+
+// NewMultiStore creates a MultiStore from the Stores in order of priority. If
+// dedupe is nil, DedupeNone is used.
+func NewMultiStore(dedupe DedupeFunc, stores ...Store) *MultiStore {
+	if dedupe == nil {
+		dedupe = DedupeNone
+	}
+	return &MultiStore{
+		stores: append([]Store(nil), stores...),
+		dedupe: dedupe,
+	}
+}
+
+// Stores returns the underlying Stores in order of priority.
+func (ms *MultiStore) Stores() []Store {
+	return append([]Store(nil), ms.stores...)
+}
+
+// NumWords implements Store. Since headwords which exist in multiple Stores
+// are counted multiple times, it is an upper bound.
+func (ms *MultiStore) NumWords() int {
+	var n int
+	for _, s := range ms.stores {
+		n += s.NumWords()
+	}
+	return n
+}
+
+// HasWord implements Store.
+func (ms *MultiStore) HasWord(word string) bool {
+	for _, s := range ms.stores {
+		if s.HasWord(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWords implements Store. The entries from each Store are concatenated in
+// order of priority, and duplicates are removed using the DedupeFunc.
+func (ms *MultiStore) GetWords(word string) ([]*Word, bool, error) {
+	var res []*Word
+	var exists bool
+	for i, s := range ms.stores {
+		ws, ok, err := s.GetWords(word)
+		if err != nil {
+			return nil, true, fmt.Errorf("store %d: %v", i, err)
+		} else if !ok {
+			continue
+		}
+		exists = true
+		prev := len(res) // only compare against higher-priority Stores
+	add:
+		for _, w := range ws {
+			for _, x := range res[:prev] {
+				if ms.dedupe(x, w) {
+					continue add
+				}
+			}
+			res = append(res, w)
+		}
+	}
+	return res, exists, nil
+}
+
+// GetWord is deprecated.
+func (ms *MultiStore) GetWord(word string) (*Word, bool, error) {
+	ws, exists, err := ms.GetWords(word)
+	if len(ws) == 0 {
+		return nil, exists, err
+	}
+	return ws[0], exists, err
+}
+
+// Headwords implements Iterator by merging the headwords from each Store. The
+// entries are returned as from GetWords. If any of the Stores do not implement
+// Iterator, the iterator will return an error.
+func (ms *MultiStore) Headwords(start, prefix string) HeadwordIterator {
+	its := make([]HeadwordIterator, len(ms.stores))
+	for i, s := range ms.stores {
+		it, err := Headwords(s, start, prefix)
+		if err != nil {
+			return errIterator{fmt.Errorf("store %d: %w", i, err)}
+		}
+		its[i] = it
+	}
+	return newMergeIterator(its, func(headword string) ([]*Word, error) {
+		ws, _, err := ms.GetWords(headword)
+		return ws, err
+	})
+}
+
+// LookupWord implements Store. The normalization is applied once across all
+// Stores, so the first normalized form of the word which exists in any of them
+// is used, and the entries for it are returned from all of them.
+func (ms *MultiStore) LookupWord(word string) ([]*Word, bool, error) {
+	return LookupWord(ms, word)
+}
+
+// Lookup is deprecated.
+func (ms *MultiStore) Lookup(word string) (*Word, bool, error) {
+	return Lookup(ms, word)
+}
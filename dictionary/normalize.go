@@ -0,0 +1,358 @@
+package dictionary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kljensen/snowball"
+)
+
+// Normalizer is a step in a Pipeline, which transforms a word to try and find
+// it in a Store.
+type Normalizer interface {
+	// Name returns the name of the step, which is used in LookupResult and
+	// ParsePipeline.
+	Name() string
+	// Normalize transforms a word. If it cannot be transformed, it should be
+	// returned as-is.
+	Normalize(store Store, word string) (string, error)
+}
+
+// LemmaNormalizer is implemented by Normalizers which replace an inflected form
+// with the headword of its lemma, so the lemma can be included in the
+// LookupResult. If it is implemented, Normalize is not used by Pipeline.
+type LemmaNormalizer interface {
+	Normalizer
+	// Lemma returns the lemma to replace the word with, or nil if there isn't
+	// one.
+	Lemma(store Store, word string) (*Lemma, error)
+}
+
+// NewNormalizer creates a Normalizer from a function which does not need to
+// access the Store.
+func NewNormalizer(name string, fn func(word string) string) Normalizer {
+	return funcNormalizer{name, fn}
+}
+
+type funcNormalizer struct {
+	name string
+	fn   func(word string) string
+}
+
+func (n funcNormalizer) Name() string {
+	return n.name
+}
+
+func (n funcNormalizer) Normalize(_ Store, word string) (string, error) {
+	return n.fn(word), nil
+}
+
+// The built-in Normalizers.
+var (
+	NormTrimSpace       = NewNormalizer("trim-space", strings.TrimSpace)
+	NormLowercase       = NewNormalizer("lowercase", strings.ToLower)
+	NormCollapseSpace   = NewNormalizer("collapse-space", func(w string) string { return normSpaceRe.ReplaceAllLiteralString(w, " ") })
+	NormTrimPunctuation = NewNormalizer("trim-punctuation", func(w string) string { return normOpenCloseRe.ReplaceAllLiteralString(w, "") })
+	NormNormalizeDashes = NewNormalizer("normalize-dashes", func(w string) string { return normDashRe.ReplaceAllLiteralString(w, "-") })
+	NormCollapseDashes  = NewNormalizer("collapse-dashes", func(w string) string { return normADashRe.ReplaceAllLiteralString(w, "-") })
+	NormRemoveDashes    = NewNormalizer("remove-dashes", func(w string) string { return strings.Replace(w, "-", "", -1) })
+	NormTrimS           = NewNormalizer("trim-s", func(w string) string { return strings.TrimRight(w, "s") })
+	NormTrimLyIng       = NewNormalizer("trim-ly-ing", func(w string) string { return strings.TrimSuffix(strings.TrimSuffix(w, "ly"), "ing") })
+
+	// NormStem stems English words using the Snowball stemmer.
+	NormStem Normalizer = NewNormalizer("stem", func(w string) string {
+		if st, err := snowball.Stem(w, "english", true); err == nil {
+			return st
+		}
+		return w
+	})
+
+	// NormFoldDiacritics folds all unicode chars into their bases.
+	NormFoldDiacritics Normalizer = NewNormalizer("fold-diacritics", func(w string) string {
+		if f, err := normFold(w); err == nil {
+			return f
+		}
+		return w
+	})
+
+	// NormInflection replaces an inflected form with the headword of its
+	// lemma (see Lemmatizer). LookupResult.Lemma is set if it matches.
+	NormInflection Normalizer = inflectionNormalizer{}
+)
+
+// inflectionNormalizer implements NormInflection.
+type inflectionNormalizer struct{}
+
+func (inflectionNormalizer) Name() string {
+	return "inflection"
+}
+
+func (n inflectionNormalizer) Normalize(store Store, word string) (string, error) {
+	l, err := n.Lemma(store, word)
+	if l == nil {
+		return word, err
+	}
+	return l.Headword, nil
+}
+
+// Lemma implements LemmaNormalizer by returning the first lemma for word which
+// exists in the store, if any.
+func (inflectionNormalizer) Lemma(store Store, word string) (*Lemma, error) {
+	ls, err := Lemmas(store, word)
+	if err != nil {
+		return nil, fmt.Errorf("error getting lemmas for '%s': %v", word, err)
+	} else if len(ls) != 0 && store.HasWord(ls[0].Headword) {
+		return &ls[0], nil
+	}
+	return nil, nil
+}
+
+// normalizers are the built-in Normalizers by name.
+var normalizers = map[string]Normalizer{}
+
+func init() {
+	for _, n := range []Normalizer{
+		NormTrimSpace, NormLowercase, NormCollapseSpace, NormTrimPunctuation,
+		NormNormalizeDashes, NormCollapseDashes, NormRemoveDashes, NormTrimS,
+		NormTrimLyIng, NormStem, NormFoldDiacritics, NormInflection,
+	} {
+		normalizers[n.Name()] = n
+	}
+}
+
+// StageMode is how the result of a Stage is used.
+type StageMode int
+
+// Stage modes.
+const (
+	StageApply   StageMode = iota // replace the word, then check if it exists
+	StageTry                      // check if the result exists, but continue with the original word if not
+	StagePrepare                  // replace the word without checking if it exists
+)
+
+var stageModes = map[StageMode]string{
+	StageApply:   "apply",
+	StageTry:     "try",
+	StagePrepare: "prepare",
+}
+
+// Stage is a step in a Pipeline.
+type Stage struct {
+	Normalizer Normalizer
+	Mode       StageMode
+}
+
+// Pipeline is a sequence of normalization steps for looking up a word. The
+// stages are run in order until the word is found.
+type Pipeline []Stage
+
+// DefaultPipeline is the Pipeline used by LookupWord.
+var DefaultPipeline = Pipeline{
+	{NormTrimSpace, StagePrepare},
+	{NormLowercase, StageApply},
+	{NormCollapseSpace, StageApply},
+	{NormTrimPunctuation, StageApply},
+	{NormNormalizeDashes, StageApply},
+	{NormCollapseDashes, StageApply},
+	{NormInflection, StageTry},
+	{NormStem, StageTry},
+	{NormTrimS, StageTry},
+	{NormFoldDiacritics, StageApply},
+	{NormInflection, StageTry},
+	{NormStem, StageTry},
+	{NormTrimS, StageTry},
+	{NormRemoveDashes, StageApply},
+}
+
+// ParsePipeline parses a comma-separated list of normalization steps, each of
+// which can be prefixed with the mode (apply, try, or prepare) and a colon
+// (e.g. "prepare:trim-space,lowercase,try:stem"). The mode defaults to apply.
+// If s is empty or "default", DefaultPipeline is returned.
+func ParsePipeline(s string) (Pipeline, error) {
+	if s = strings.TrimSpace(s); s == "" || s == "default" {
+		return append(Pipeline(nil), DefaultPipeline...), nil
+	}
+
+	var p Pipeline
+	for _, x := range strings.Split(s, ",") {
+		st := Stage{Mode: StageApply}
+		name := strings.TrimSpace(x)
+		if i := strings.IndexByte(name, ':'); i != -1 {
+			var ok bool
+			for m, ms := range stageModes {
+				if ms == name[:i] {
+					st.Mode, ok = m, true
+				}
+			}
+			if !ok {
+				return nil, fmt.Errorf("invalid mode %q for step %q", name[:i], name[i+1:])
+			}
+			name = name[i+1:]
+		}
+		if n, ok := normalizers[name]; ok {
+			st.Normalizer = n
+		} else {
+			names := make([]string, 0, len(normalizers))
+			for n := range normalizers {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown step %q (must be one of %s)", name, strings.Join(names, ", "))
+		}
+		p = append(p, st)
+	}
+	return p, nil
+}
+
+// String returns the pipeline in the format used by ParsePipeline.
+func (p Pipeline) String() string {
+	ss := make([]string, len(p))
+	for i, st := range p {
+		if st.Mode == StageApply {
+			ss[i] = st.Normalizer.Name()
+		} else {
+			ss[i] = stageModes[st.Mode] + ":" + st.Normalizer.Name()
+		}
+	}
+	return strings.Join(ss, ",")
+}
+
+// LookupOptions restricts how a word is looked up. The zero value only
+// normalizes case, whitespace, punctuation, and dashes.
+type LookupOptions struct {
+	Exact          bool // only match the word as-is, or ignoring case and whitespace (the other options are ignored)
+	FoldDiacritics bool // try the word without diacritics
+	Stem           bool // try inflected forms, stems, and trailing s (e.g. "runs" to "run")
+	AllCandidates  bool // return the words for every match rather than the first one
+}
+
+// DefaultLookupOptions are the options used by LookupWord.
+var DefaultLookupOptions = LookupOptions{
+	FoldDiacritics: true,
+	Stem:           true,
+}
+
+// WithOptions returns the stages of the pipeline allowed by the options.
+func (p Pipeline) WithOptions(o LookupOptions) Pipeline {
+	var np Pipeline
+	for _, st := range p {
+		switch st.Normalizer.Name() {
+		case NormTrimSpace.Name(), NormLowercase.Name(), NormCollapseSpace.Name():
+		case NormFoldDiacritics.Name():
+			if o.Exact || !o.FoldDiacritics {
+				continue
+			}
+		case NormInflection.Name(), NormStem.Name(), NormTrimS.Name(), NormTrimLyIng.Name():
+			if o.Exact || !o.Stem {
+				continue
+			}
+		default:
+			if o.Exact {
+				continue
+			}
+		}
+		np = append(np, st)
+	}
+	return np
+}
+
+// Lookup looks up a word by running the stages in order until it exists in
+// the Store. The word is only checked after apply and try stages.
+func (p Pipeline) Lookup(store Store, word string) ([]*Word, *LookupResult, bool, error) {
+	return p.lookup(store, word, false, false)
+}
+
+// LookupOptions is like Lookup, but only runs the stages allowed by the
+// options. If Exact is set, the word is checked as-is before running the
+// stages, so it is found even if the remaining stages (if any) would change it.
+// If AllCandidates is set, every stage is run, and the words for each headword
+// which matched are returned in order (see LookupResult.Candidates).
+func (p Pipeline) LookupOptions(store Store, word string, o LookupOptions) ([]*Word, *LookupResult, bool, error) {
+	return p.WithOptions(o).lookup(store, word, o.Exact, o.AllCandidates)
+}
+
+func (p Pipeline) lookup(store Store, word string, asIs, all bool) ([]*Word, *LookupResult, bool, error) {
+	var lemma *Lemma
+	var steps []string
+	var res []*LookupResult
+
+	if asIs && store.HasWord(word) {
+		res = append(res, &LookupResult{
+			Input: word,
+			Key:   word,
+			Steps: []string{},
+		})
+	}
+
+	ws := word
+	for _, st := range p {
+		if len(res) != 0 && !all {
+			break
+		}
+
+		var s string
+		var l *Lemma
+		var err error
+		if n, ok := st.Normalizer.(LemmaNormalizer); ok {
+			if l, err = n.Lemma(store, ws); l != nil {
+				s = l.Headword
+			} else if err == nil && st.Mode == StageTry {
+				continue // nothing to try
+			} else {
+				s = ws
+			}
+		} else {
+			s, err = st.Normalizer.Normalize(store, ws)
+		}
+		if err != nil {
+			return nil, nil, true, err
+		}
+
+		ss, sl := steps, lemma
+		if s != ws {
+			ss = append(append([]string{}, steps...), st.Normalizer.Name())
+		}
+		if l != nil {
+			sl = l
+		}
+		if st.Mode != StageTry {
+			ws, steps, lemma = s, ss, sl
+		}
+		if st.Mode == StagePrepare || !store.HasWord(s) {
+			continue
+		}
+
+		var seen bool
+		for _, r := range res {
+			seen = seen || r.Key == s
+		}
+		if !seen {
+			res = append(res, &LookupResult{
+				Input: word,
+				Key:   s,
+				Steps: append([]string{}, ss...),
+				Lemma: sl,
+			})
+		}
+	}
+	if len(res) == 0 {
+		return nil, nil, false, nil
+	}
+
+	var words []*Word
+	for _, r := range res {
+		w, exists, err := store.GetWords(r.Key)
+		if err != nil {
+			return nil, nil, true, fmt.Errorf("error getting word '%s': %v", r.Key, err)
+		} else if !exists {
+			panic("word should exist if HasWord")
+		}
+		words = append(words, w...)
+	}
+
+	if len(res) > 1 {
+		res[0].Candidates = res[1:]
+	}
+	return words, res[0], true, nil
+}
@@ -0,0 +1,414 @@
+package dictionary
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kljensen/snowball"
+)
+
+func TestNormalizers(t *testing.T) {
+	for _, c := range []struct {
+		n       Normalizer
+		in, exp string
+	}{
+		{NormTrimSpace, " \tcat \n", "cat"},
+		{NormTrimSpace, "new york", "new york"},
+		{NormLowercase, "New YORK", "new york"},
+		{NormLowercase, "ÉCOLE", "école"},
+		{NormCollapseSpace, "new \t\n york", "new york"},
+		{NormCollapseSpace, " cat ", " cat "},
+		{NormTrimPunctuation, `"cat"`, "cat"},
+		{NormTrimPunctuation, "“cat”", "cat"},
+		{NormTrimPunctuation, "((cat))", "cat"},
+		{NormTrimPunctuation, "'tis", "tis"},
+		{NormTrimPunctuation, "c(a)t", "c(a)t"},
+		{NormNormalizeDashes, "tea—cup", "tea-cup"},
+		{NormNormalizeDashes, "tea–cup‐s", "tea-cup-s"},
+		{NormCollapseDashes, "tea---cup", "tea-cup"},
+		{NormCollapseDashes, "tea-cup", "tea-cup"},
+		{NormRemoveDashes, "to-day-", "today"},
+		{NormTrimS, "catss", "cat"},
+		{NormTrimS, "cat", "cat"},
+		{NormTrimLyIng, "quickly", "quick"},
+		{NormTrimLyIng, "singing", "sing"},
+		{NormTrimLyIng, "kingly", "k"}, // both are removed
+		{NormTrimLyIng, "lying", "ly"},
+		{NormStem, "running", "run"},
+		{NormStem, "cats", "cat"},
+		{NormStem, "cat", "cat"},
+		{NormFoldDiacritics, "naïve", "naive"},
+		{NormFoldDiacritics, "résumé", "resume"},
+		{NormFoldDiacritics, "cat", "cat"},
+	} {
+		if act, err := c.n.Normalize(nil, c.in); err != nil {
+			t.Errorf("%s %q: unexpected error: %v", c.n.Name(), c.in, err)
+		} else if act != c.exp {
+			t.Errorf("%s %q: expected %q, got %q", c.n.Name(), c.in, c.exp, act)
+		}
+	}
+
+	wm := WordMap{
+		"run":  {{Word: "run", Inflections: []Inflection{{"ran", []string{"past"}}}}},
+		"go":   {{Word: "go", Inflections: []Inflection{{"went", []string{"past"}}}}},
+		"wend": {{Word: "wend", Inflections: []Inflection{{"went", []string{"past"}}}}},
+	}
+	for _, c := range []struct {
+		in, exp string
+	}{
+		{"ran", "run"},
+		{"went", "go"}, // the first lemma
+		{"run", "run"},
+		{"cat", "cat"},
+	} {
+		if act, err := NormInflection.Normalize(wm, c.in); err != nil {
+			t.Errorf("%s %q: unexpected error: %v", NormInflection.Name(), c.in, err)
+		} else if act != c.exp {
+			t.Errorf("%s %q: expected %q, got %q", NormInflection.Name(), c.in, c.exp, act)
+		}
+	}
+}
+
+func TestParsePipeline(t *testing.T) {
+	for _, c := range []struct {
+		in  string
+		exp Pipeline
+		str string // if different from in
+	}{
+		{"", DefaultPipeline, DefaultPipeline.String()},
+		{"default", DefaultPipeline, DefaultPipeline.String()},
+		{"lowercase", Pipeline{{NormLowercase, StageApply}}, ""},
+		{"apply:lowercase", Pipeline{{NormLowercase, StageApply}}, "lowercase"},
+		{" prepare:trim-space , lowercase,try:stem ", Pipeline{
+			{NormTrimSpace, StagePrepare},
+			{NormLowercase, StageApply},
+			{NormStem, StageTry},
+		}, "prepare:trim-space,lowercase,try:stem"},
+		{"prepare:trim-space,lowercase,collapse-space,trim-punctuation,normalize-dashes,collapse-dashes,try:inflection,try:stem,try:trim-s,fold-diacritics,try:inflection,try:stem,try:trim-s,remove-dashes", DefaultPipeline, ""},
+		{"try:trim-ly-ing,try:trim-ly-ing", Pipeline{{NormTrimLyIng, StageTry}, {NormTrimLyIng, StageTry}}, ""},
+	} {
+		p, err := ParsePipeline(c.in)
+		if err != nil {
+			t.Errorf("parse %q: unexpected error: %v", c.in, err)
+			continue
+		}
+		if p.String() != c.exp.String() { // the normalizers can't be compared directly since they contain funcs
+			t.Errorf("parse %q: expected %s, got %s", c.in, c.exp, p)
+		}
+		if c.str == "" {
+			c.str = c.in
+		}
+		if s := p.String(); s != c.str {
+			t.Errorf("parse %q: expected string %q, got %q", c.in, c.str, s)
+		} else if p2, err := ParsePipeline(s); err != nil || p2.String() != s {
+			t.Errorf("parse %q: round-trip of %q: got %s, %v", c.in, s, p2, err)
+		}
+	}
+
+	for _, c := range []struct {
+		in, err string
+	}{
+		{"foo:stem", `invalid mode "foo" for step "stem"`},
+		{"lowercase,:stem", `invalid mode "" for step "stem"`},
+		{"lowercase,stemming", `unknown step "stemming" (must be one of collapse-dashes, collapse-space, fold-diacritics, inflection, lowercase, normalize-dashes, remove-dashes, stem, trim-ly-ing, trim-punctuation, trim-s, trim-space)`},
+		{"lowercase,", `unknown step ""`},
+		{"try:", `unknown step ""`},
+	} {
+		if _, err := ParsePipeline(c.in); err == nil {
+			t.Errorf("parse %q: expected error", c.in)
+		} else if !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("parse %q: expected error %q, got %q", c.in, c.err, err)
+		}
+	}
+
+	// the default pipeline isn't shared
+	p, _ := ParsePipeline("default")
+	p[0] = Stage{NormLowercase, StageTry}
+	if DefaultPipeline[0].Mode != StagePrepare || DefaultPipeline[0].Normalizer.Name() != NormTrimSpace.Name() {
+		t.Errorf("modifying the parsed default pipeline changed DefaultPipeline")
+	}
+}
+
+// TestDefaultPipelineLegacy checks DefaultPipeline finds the same entries as
+// the hard-coded LookupWord from before normalization pipelines were added
+// (lookupWordLegacy). Since the old one didn't use inflections, the WordMap
+// doesn't have any.
+func TestDefaultPipelineLegacy(t *testing.T) {
+	wm := WordMap{}
+	for _, hw := range []string{
+		"a", "cat", "run", "color", "today", "tea-cup", "new york", "naive",
+		"résumé", "quick", "xyz", "s", "co-operate", "é",
+		"NASA", "Bob", " cat", "dog ", // not lowercase or trimmed, so they should never be found
+		"new  york",
+	} {
+		wm[hw] = []*Word{{Word: hw}}
+	}
+	wm["run"] = append(wm["run"], &Word{Word: "run", Info: "Run, n."})
+
+	for _, c := range []struct {
+		in  string
+		exp string // or empty if not found
+	}{
+		{"", ""},
+		{"cat", "cat"},
+		{"Cat", "cat"},
+		{"  CAT \n", "cat"},
+		{" new\tyork ", "new york"},
+		{`"cat"`, "cat"},
+		{"“Cat”", "cat"},
+		{"(cat)", "cat"},
+		{"tea—cup", "tea-cup"},
+		{"tea--cup", "tea-cup"},
+		{"tea––cup", "tea-cup"},
+		{"teacup", ""},
+		{"to-day", "today"},
+		{"to--day", "today"},
+		{"To—Day", "today"},
+		{"co-operate", "co-operate"},
+		{"cooperate", ""},
+		{"cats", "cat"},
+		{"catss", "cat"},
+		{"running", "run"},
+		{"runs", "run"},
+		{"Colors", "color"},
+		{"colors'", "color"},
+		{"quickly", "quick"},
+		{"naïve", "naive"},
+		{"Naïves", "naive"},
+		{"résumé", "résumé"},
+		{"resume", ""},
+		{"RÉSUMÉ", "résumé"},
+		{"é", "é"},
+		{"e", ""},
+		{"ss", ""}, // trim-s removes every s
+		{"a", "a"},
+		{"A", "a"},
+		{"as", "a"},
+		{"xyzing", ""}, // not stemmed, and would be found by trim-ly-ing, but the legacy check for it was dead code (see below)
+		{"xyzly", ""},
+		{"to-days", ""}, // dashes are removed last
+		{"to—day's", ""},
+		{"dog", ""},
+		{"dog ", ""},
+		{" cat", "cat"},
+		{"NASA", ""},
+		{"nasa", ""},
+		{"Bob", ""},
+		{"new  york", "new  york"},
+		{"New  York", "new  york"},
+		{"New   York", "new york"},
+	} {
+		lws, lok, lerr := lookupWordLegacy(wm, c.in)
+		if lerr != nil {
+			t.Fatalf("legacy %q: unexpected error: %v", c.in, lerr)
+		}
+		ws, res, ok, err := DefaultPipeline.Lookup(wm, c.in)
+		if err != nil {
+			t.Fatalf("lookup %q: unexpected error: %v", c.in, err)
+		}
+		if ok != lok || !reflect.DeepEqual(ws, lws) {
+			t.Errorf("lookup %q: doesn't match legacy: expected %v %s, got %v %s", c.in, lok, testWordNames(lws), ok, testWordNames(ws))
+		}
+		if c.exp == "" {
+			if ok {
+				t.Errorf("lookup %q: expected not found, got %q", c.in, res.Key)
+			}
+		} else if !ok {
+			t.Errorf("lookup %q: expected %q, got not found", c.in, c.exp)
+		} else if res.Key != c.exp || !reflect.DeepEqual(ws, wm[c.exp]) {
+			t.Errorf("lookup %q: expected %q, got %q (%s)", c.in, c.exp, res.Key, testWordNames(ws))
+		}
+	}
+
+	// trim-ly-ing can still be used in a custom pipeline
+	p, _ := ParsePipeline("lowercase,try:stem,try:trim-ly-ing")
+	if _, res, ok, _ := p.Lookup(wm, "xyzly"); !ok || res.Key != "xyz" || !reflect.DeepEqual(res.Steps, []string{"trim-ly-ing"}) {
+		t.Errorf("lookup with trim-ly-ing: expected xyz, got %+v", res)
+	}
+}
+
+func TestPipelineLookupAsIs(t *testing.T) {
+	wm := WordMap{}
+	for _, hw := range []string{"cat", "NASA", " cat", "run"} {
+		wm[hw] = []*Word{{Word: hw}}
+	}
+	trims, _ := ParsePipeline("try:trim-s") // doesn't change the case, unlike the stemmer
+
+	for _, c := range []struct {
+		p     Pipeline
+		o     *LookupOptions
+		in    string
+		key   string // or empty if not found
+		steps []string
+	}{
+		{trims, nil, "cat", "cat", []string{}}, // checked by the try stage
+		{trims, nil, "Cat", "", nil},           // without lowercase, case matters
+		{trims, nil, "cats", "cat", []string{"trim-s"}},
+		{DefaultPipeline, nil, "NASA", "", nil}, // only with Exact
+		{DefaultPipeline, nil, " cat", "cat", []string{"trim-space"}},
+		{trims, &LookupOptions{Exact: true}, "cat", "cat", []string{}}, // without any stages
+		{trims, &LookupOptions{Exact: true}, "cats", "", nil},
+		{DefaultPipeline, &LookupOptions{Exact: true}, "Cat", "cat", []string{"lowercase"}}, // case is still ignored
+		{DefaultPipeline, &LookupOptions{Exact: true}, "NASA", "NASA", []string{}},
+		{DefaultPipeline, &LookupOptions{Exact: true}, "nasa", "", nil},
+		{DefaultPipeline, &LookupOptions{Exact: true}, " cat", " cat", []string{}},
+		{DefaultPipeline, &LookupOptions{Exact: true}, "  cat", "cat", []string{"trim-space"}},
+		{DefaultPipeline, &LookupOptions{Exact: true}, "running", "", nil},
+	} {
+		var res *LookupResult
+		var ok bool
+		var err error
+		if c.o == nil {
+			_, res, ok, err = c.p.Lookup(wm, c.in)
+		} else {
+			_, res, ok, err = c.p.LookupOptions(wm, c.in, *c.o)
+		}
+		if err != nil {
+			t.Errorf("lookup %q with %s: unexpected error: %v", c.in, c.p, err)
+		} else if c.key == "" {
+			if ok {
+				t.Errorf("lookup %q with %s: expected not found, got %+v", c.in, c.p, res)
+			}
+		} else if !ok {
+			t.Errorf("lookup %q with %s: expected %q, got not found", c.in, c.p, c.key)
+		} else if res.Key != c.key || !reflect.DeepEqual(res.Steps, c.steps) {
+			t.Errorf("lookup %q with %s: expected %q %q, got %q %q", c.in, c.p, c.key, c.steps, res.Key, res.Steps)
+		}
+	}
+
+	// the word as-is is the first candidate
+	if _, res, ok, _ := DefaultPipeline.LookupOptions(wm, " cat", LookupOptions{Exact: true, AllCandidates: true}); !ok || res.Key != " cat" || len(res.Candidates) != 1 || res.Candidates[0].Key != "cat" {
+		t.Errorf("lookup all: expected \" cat\" then \"cat\", got %+v", res)
+	}
+}
+
+// testLemmaNormalizer is a LemmaNormalizer which doesn't use the Store.
+type testLemmaNormalizer map[string]Lemma
+
+func (testLemmaNormalizer) Name() string {
+	return "test-lemma"
+}
+
+func (n testLemmaNormalizer) Normalize(store Store, word string) (string, error) {
+	panic("Normalize should not be called if Lemma is implemented")
+}
+
+func (n testLemmaNormalizer) Lemma(store Store, word string) (*Lemma, error) {
+	if l, ok := n[word]; ok {
+		return &l, nil
+	}
+	return nil, nil
+}
+
+func TestPipelineLemmaNormalizer(t *testing.T) {
+	wm := WordMap{"go": {{Word: "go"}}}
+	n := testLemmaNormalizer{"went": {"go", "went", []string{"past"}}}
+
+	for _, mode := range []StageMode{StageApply, StageTry} {
+		_, res, ok, err := Pipeline{{NormLowercase, StageApply}, {n, mode}}.Lookup(wm, "Went")
+		if err != nil || !ok {
+			t.Errorf("mode %d: expected found, got %v %v", mode, ok, err)
+		} else if exp := (&LookupResult{Input: "Went", Key: "go", Steps: []string{"lowercase", "test-lemma"}, Lemma: &Lemma{"go", "went", []string{"past"}}}); !reflect.DeepEqual(res, exp) {
+			t.Errorf("mode %d: expected %+v, got %+v", mode, exp, res)
+		}
+		if _, _, ok, err := (Pipeline{{n, mode}}).Lookup(wm, "gone"); ok || err != nil {
+			t.Errorf("mode %d: expected not found, got %v %v", mode, ok, err)
+		}
+	}
+}
+
+func testWordNames(ws []*Word) string {
+	ss := make([]string, len(ws))
+	for i, w := range ws {
+		ss[i] = w.Word
+	}
+	return fmt.Sprintf("%q", ss)
+}
+
+// lookupWordLegacy is LookupWord from before it was implemented with
+// DefaultPipeline, with normTransform replaced by normFold. Note that the
+// trim-ly-ing check uses ws rather than wst, so it never matches anything
+// which wasn't already checked, and that the second iteration of the outer
+// loop starts over from the original word, so it checks the same things again.
+func lookupWordLegacy(store Store, word string) ([]*Word, bool, error) {
+	var err error
+
+	ws := word
+
+	for a := 0; a < 2; a++ {
+		// trim leading and trailing spaces
+		if ws = strings.ToLower(strings.TrimSpace(word)); store.HasWord(ws) {
+			goto found
+		}
+
+		// collapse all whitespace into a single space
+		if ws = normSpaceRe.ReplaceAllLiteralString(ws, " "); store.HasWord(ws) {
+			goto found
+		}
+
+		// trim leading and trailing opening/closing punctuation
+		if ws = normOpenCloseRe.ReplaceAllLiteralString(ws, ""); store.HasWord(ws) {
+			goto found
+		}
+
+		// replace all unicode dash-like characters with a dash
+		if ws = normDashRe.ReplaceAllLiteralString(ws, "-"); store.HasWord(ws) {
+			goto found
+		}
+
+		// collapse multiple dashes
+		if ws = normADashRe.ReplaceAllLiteralString(ws, "-"); store.HasWord(ws) {
+			goto found
+		}
+
+		for b := 0; b < 2; b++ {
+			// stem
+			if wst, err := snowball.Stem(ws, "english", true); err == nil && store.HasWord(wst) {
+				ws = wst
+				goto found
+			}
+
+			// sometimes stemming removes too much
+			if wst := strings.TrimRight(ws, "s"); store.HasWord(wst) {
+				ws = wst
+				goto found
+			}
+
+			// sometimes stemming removes too much
+			if wst := strings.TrimSuffix(strings.TrimSuffix(ws, "ly"), "ing"); store.HasWord(ws) {
+				ws = wst
+				goto found
+			}
+
+			// try again, but fold all unicode chars into their bases
+			if b == 0 {
+				if ws, err = normFold(ws); err != nil {
+					break
+				} else if store.HasWord(ws) {
+					goto found
+				}
+			}
+		}
+
+		// try again, but remove dashes
+		if a == 0 {
+			if ws = strings.Replace(ws, "-", "", -1); store.HasWord(ws) {
+				goto found
+			}
+		}
+	}
+
+	return nil, false, nil
+
+found:
+	w, exists, err := store.GetWords(ws)
+	if err != nil {
+		return nil, true, fmt.Errorf("error getting word '%s': %v", ws, err)
+	} else if !exists {
+		panic("word should exist if HasWord")
+	}
+
+	return w, true, nil
+}
@@ -0,0 +1,388 @@
+package dictionary
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OverlayAction is the change an Overlay makes to a headword.
+type OverlayAction string
+
+// Overlay actions.
+const (
+	OverlayAdd     OverlayAction = "add"     // the entries are returned after the ones from the base Store
+	OverlayReplace OverlayAction = "replace" // the entries are returned instead of the ones from the base Store
+	OverlayHide    OverlayAction = "hide"    // the headword is hidden
+)
+
+// OverlayEntry is the change an Overlay makes to a headword.
+type OverlayEntry struct {
+	Action OverlayAction `json:"action"`
+	Words  []*Word       `json:"words,omitempty"`
+}
+
+// Overlay is a small editable set of changes to headwords, stored as a JSON
+// file. Changes are saved to the file immediately. It is safe for concurrent
+// use, but not by multiple processes at once.
+//
+// Headwords are lowercased and trimmed in the same way as by Parse, so they
+// match the ones in the dictionary.
+type Overlay struct {
+	file    string
+	mu      sync.RWMutex
+	entries map[string]*OverlayEntry
+	infl    map[string][]string // inflected forms to the visible headwords listing them
+}
+
+// overlayFile is the format of an overlay file.
+type overlayFile struct {
+	Headwords map[string]*OverlayEntry `json:"headwords"`
+}
+
+// OpenOverlay opens an overlay file. If it does not exist, it will be created
+// when the first change is made.
+func OpenOverlay(file string) (*Overlay, error) {
+	o := &Overlay{file: file}
+	if err := o.Reload(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Reload re-reads the overlay file.
+func (o *Overlay) Reload() error {
+	buf, err := ioutil.ReadFile(o.file)
+	if os.IsNotExist(err) {
+		o.mu.Lock()
+		o.entries, o.infl = map[string]*OverlayEntry{}, nil
+		o.mu.Unlock()
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read overlay: %v", err)
+	}
+
+	var of overlayFile
+	if err := json.Unmarshal(buf, &of); err != nil {
+		return fmt.Errorf("could not parse overlay: %v", err)
+	}
+	entries := make(map[string]*OverlayEntry, len(of.Headwords))
+	for hw, e := range of.Headwords {
+		if e == nil {
+			return fmt.Errorf("could not parse overlay: %#v: missing entry", hw)
+		}
+		switch e.Action {
+		case OverlayAdd, OverlayReplace, OverlayHide:
+		default:
+			return fmt.Errorf("could not parse overlay: %#v: invalid action %#v", hw, e.Action)
+		}
+		for _, w := range e.Words {
+			if w == nil {
+				return fmt.Errorf("could not parse overlay: %#v: null word", hw)
+			}
+		}
+		nhw := overlayHeadword(hw)
+		if nhw == "" {
+			return fmt.Errorf("could not parse overlay: %#v: empty headword", hw)
+		} else if _, ok := entries[nhw]; ok {
+			return fmt.Errorf("could not parse overlay: %#v: duplicate headword %#v", hw, nhw)
+		}
+		entries[nhw] = e
+	}
+
+	o.mu.Lock()
+	o.entries, o.infl = entries, overlayInflections(entries)
+	o.mu.Unlock()
+	return nil
+}
+
+// Headwords returns the headwords changed by the overlay in sorted order.
+func (o *Overlay) Headwords() []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	hws := make([]string, 0, len(o.entries))
+	for hw := range o.entries {
+		hws = append(hws, hw)
+	}
+	sort.Strings(hws)
+	return hws
+}
+
+// Get gets a copy of the change for a headword.
+func (o *Overlay) Get(headword string) (OverlayEntry, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	e, ok := o.entries[overlayHeadword(headword)]
+	if !ok {
+		return OverlayEntry{}, false
+	}
+	return OverlayEntry{
+		Action: e.Action,
+		Words:  cloneWords(e.Words),
+	}, true
+}
+
+// words returns copies of the visible entries.
+func (o *Overlay) words() WordMap {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	wm := WordMap{}
+	for hw, e := range o.entries {
+		if e.visible() {
+			wm[hw] = cloneWords(e.Words)
+		}
+	}
+	return wm
+}
+
+// Add adds entries for a headword. If the headword was hidden, the entries
+// replace the ones from the base Store.
+func (o *Overlay) Add(headword string, ws ...*Word) error {
+	return o.update(headword, func(e *OverlayEntry) *OverlayEntry {
+		switch {
+		case e == nil:
+			return &OverlayEntry{Action: OverlayAdd, Words: cloneWords(ws)}
+		case e.Action == OverlayHide:
+			return &OverlayEntry{Action: OverlayReplace, Words: cloneWords(ws)}
+		default:
+			return &OverlayEntry{Action: e.Action, Words: append(cloneWords(e.Words), cloneWords(ws)...)}
+		}
+	})
+}
+
+// Replace replaces the entries for a headword.
+func (o *Overlay) Replace(headword string, ws ...*Word) error {
+	return o.update(headword, func(*OverlayEntry) *OverlayEntry {
+		return &OverlayEntry{Action: OverlayReplace, Words: cloneWords(ws)}
+	})
+}
+
+// Hide hides a headword.
+func (o *Overlay) Hide(headword string) error {
+	return o.update(headword, func(*OverlayEntry) *OverlayEntry {
+		return &OverlayEntry{Action: OverlayHide}
+	})
+}
+
+// Reset removes the changes for a headword.
+func (o *Overlay) Reset(headword string) error {
+	return o.update(headword, func(*OverlayEntry) *OverlayEntry {
+		return nil
+	})
+}
+
+// update changes the entry for a headword and saves the overlay. If fn returns
+// nil, the entry is removed.
+func (o *Overlay) update(headword string, fn func(e *OverlayEntry) *OverlayEntry) error {
+	if headword = overlayHeadword(headword); headword == "" {
+		return fmt.Errorf("could not update overlay: empty headword")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make(map[string]*OverlayEntry, len(o.entries)+1)
+	for hw, e := range o.entries {
+		entries[hw] = e
+	}
+	if e := fn(entries[headword]); e != nil {
+		entries[headword] = e
+	} else {
+		delete(entries, headword)
+	}
+
+	buf, err := json.MarshalIndent(overlayFile{entries}, "", "    ")
+	if err != nil {
+		return fmt.Errorf("could not encode overlay: %v", err)
+	}
+
+	// write to a temp file then rename it so the overlay is never partially written
+	tmp, err := ioutil.TempFile(filepath.Dir(o.file), "."+filepath.Base(o.file)+".*")
+	if err != nil {
+		return fmt.Errorf("could not save overlay: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(buf, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not save overlay: %v", err)
+	} else if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not save overlay: %v", err)
+	} else if err := os.Rename(tmp.Name(), o.file); err != nil {
+		return fmt.Errorf("could not save overlay: %v", err)
+	}
+
+	o.entries, o.infl = entries, overlayInflections(entries)
+	return nil
+}
+
+// overlayHeadword normalizes a headword in the same way as Parse.
+func overlayHeadword(headword string) string {
+	return strings.ToLower(strings.TrimSpace(headword))
+}
+
+// overlayInflections indexes the inflected forms of the visible entries.
+func overlayInflections(entries map[string]*OverlayEntry) map[string][]string {
+	infl := map[string][]string{}
+	for hw, e := range entries {
+		if !e.visible() {
+			continue
+		}
+		for _, w := range e.Words {
+			for _, f := range w.Inflections {
+				infl[f.Form] = appendUnique(infl[f.Form], hw)
+			}
+		}
+	}
+	for _, hws := range infl {
+		sort.Strings(hws)
+	}
+	return infl
+}
+
+// OverlayStore applies an Overlay on top of a read-only Store.
+type OverlayStore struct {
+	base Store
+	ov   *Overlay
+}
+
+// NewOverlayStore creates a Store which applies the changes from ov to base.
+// Changes made to ov are visible immediately.
+func NewOverlayStore(base Store, ov *Overlay) *OverlayStore {
+	return &OverlayStore{base, ov}
+}
+
+// Base returns the underlying Store.
+func (s *OverlayStore) Base() Store {
+	return s.base
+}
+
+// Overlay returns the underlying Overlay.
+func (s *OverlayStore) Overlay() *Overlay {
+	return s.ov
+}
+
+// NumWords implements Store.
+func (s *OverlayStore) NumWords() int {
+	n := s.base.NumWords()
+	s.ov.mu.RLock()
+	defer s.ov.mu.RUnlock()
+	for hw, e := range s.ov.entries {
+		switch inBase, visible := s.base.HasWord(hw), e.visible(); {
+		case inBase && !visible:
+			n--
+		case !inBase && visible:
+			n++
+		}
+	}
+	return n
+}
+
+// HasWord implements Store.
+func (s *OverlayStore) HasWord(word string) bool {
+	s.ov.mu.RLock()
+	e, ok := s.ov.entries[word]
+	s.ov.mu.RUnlock()
+	if ok && e.Action != OverlayAdd {
+		return e.visible()
+	}
+	return s.base.HasWord(word) || (ok && e.visible())
+}
+
+// GetWords implements Store. The entries from the overlay are copied, so they
+// are safe to modify.
+func (s *OverlayStore) GetWords(word string) ([]*Word, bool, error) {
+	s.ov.mu.RLock()
+	e, ok := s.ov.entries[word]
+	s.ov.mu.RUnlock()
+
+	if ok && e.Action != OverlayAdd {
+		if !e.visible() {
+			return nil, false, nil
+		}
+		return cloneWords(e.Words), true, nil
+	}
+
+	ws, exists, err := s.base.GetWords(word)
+	if err != nil {
+		return nil, exists, err
+	}
+	if ok && e.visible() {
+		// the slice from the base store may be shared (e.g. a WordMap value)
+		out := make([]*Word, 0, len(ws)+len(e.Words))
+		out = append(append(out, ws...), cloneWords(e.Words)...)
+		return out, true, nil
+	}
+	return ws, exists, nil
+}
+
+// GetWord is deprecated.
+func (s *OverlayStore) GetWord(word string) (*Word, bool, error) {
+	ws, exists, err := s.GetWords(word)
+	if len(ws) == 0 {
+		return nil, exists, err
+	}
+	return ws[0], exists, err
+}
+
+// Headwords implements Iterator by merging the headwords from the base Store
+// with the ones added by the overlay, and skipping hidden ones. If the base
+// Store does not implement Iterator, the iterator will return an error.
+func (s *OverlayStore) Headwords(start, prefix string) HeadwordIterator {
+	it, err := Headwords(s.base, start, prefix)
+	if err != nil {
+		return errIterator{err}
+	}
+	words := func(headword string) ([]*Word, error) {
+		ws, _, err := s.GetWords(headword)
+		return ws, err
+	}
+	return &overlayIterator{newMergeIterator([]HeadwordIterator{
+		it, newSliceIterator(s.ov.Headwords(), start, prefix, words),
+	}, words), s}
+}
+
+// overlayIterator skips headwords hidden by the overlay.
+type overlayIterator struct {
+	*mergeIterator
+	s *OverlayStore
+}
+
+func (it *overlayIterator) Next() bool {
+	for it.mergeIterator.Next() {
+		if _, ok := it.s.ov.Get(it.Headword()); !ok || it.s.HasWord(it.Headword()) {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupWord implements Store.
+func (s *OverlayStore) LookupWord(word string) ([]*Word, bool, error) {
+	return LookupWord(s, word)
+}
+
+// Lookup is deprecated.
+func (s *OverlayStore) Lookup(word string) (*Word, bool, error) {
+	return Lookup(s, word)
+}
+
+// visible checks if the entry makes the headword exist.
+func (e *OverlayEntry) visible() bool {
+	return e.Action != OverlayHide && len(e.Words) != 0
+}
+
+func cloneWords(ws []*Word) []*Word {
+	if ws == nil {
+		return nil
+	}
+	c := make([]*Word, len(ws))
+	for i, w := range ws {
+		c[i] = w.clone()
+	}
+	return c
+}
@@ -0,0 +1,151 @@
+package dictionary
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestOverlayHeadwords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dictserver")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "overlay.json")
+	ov, err := OpenOverlay(fn)
+	if err != nil {
+		t.Fatalf("open overlay: %v", err)
+	}
+	s := NewOverlayStore(WordMap{"cat": {{Word: "cat"}}}, ov)
+
+	if err := ov.Hide("Cat"); err != nil {
+		t.Fatalf("hide: %v", err)
+	}
+	if s.HasWord("cat") {
+		t.Errorf("expected cat to be hidden")
+	}
+	if err := ov.Add(" Foo ", &Word{Word: "foo"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if ws, ok, _ := s.GetWords("foo"); !ok || len(ws) != 1 {
+		t.Errorf("expected foo to be added, got %v %v", ok, ws)
+	}
+	if _, ok := ov.Get("FOO"); !ok {
+		t.Errorf("expected to get foo")
+	}
+	if err := ov.Add(" ", &Word{Word: "foo"}); err == nil {
+		t.Errorf("expected error adding empty headword")
+	}
+	if exp := []string{"cat", "foo"}; !reflect.DeepEqual(ov.Headwords(), exp) {
+		t.Errorf("expected headwords %q, got %q", exp, ov.Headwords())
+	}
+
+	// headwords from the file are normalized too
+	if err := ioutil.WriteFile(fn, []byte(`{"headwords":{"Bar":{"action":"hide"}}}`), 0644); err != nil {
+		t.Fatalf("write overlay: %v", err)
+	}
+	if err := ov.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if exp := []string{"bar"}; !reflect.DeepEqual(ov.Headwords(), exp) {
+		t.Errorf("expected headwords %q, got %q", exp, ov.Headwords())
+	}
+	if err := ioutil.WriteFile(fn, []byte(`{"headwords":{"Bar":{"action":"hide"},"bar":{"action":"hide"}}}`), 0644); err != nil {
+		t.Fatalf("write overlay: %v", err)
+	}
+	if err := ov.Reload(); err == nil {
+		t.Errorf("expected error for duplicate headwords")
+	}
+}
+
+func TestOverlaySearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dictserver")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := OpenBytes(testWriterFile(t))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer d.Close()
+
+	ov, err := OpenOverlay(filepath.Join(dir, "overlay.json"))
+	if err != nil {
+		t.Fatalf("open overlay: %v", err)
+	}
+	s := NewOverlayStore(d, ov)
+
+	if err := ov.Replace("lead", &Word{Word: "lead", Meanings: []WordMeaning{{Text: "A soft metal."}}}); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if err := ov.Hide("zebra"); err != nil {
+		t.Fatalf("hide: %v", err)
+	}
+	if err := ov.Add("quagga", &Word{Word: "quagga", Meanings: []WordMeaning{{Text: "A striped animal, like a zebra."}}}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	meanings := func(ws []*Word) []string {
+		var ms []string
+		for _, w := range ws {
+			ms = append(ms, w.Word+": "+w.Meanings[0].Text)
+		}
+		return ms
+	}
+	for _, c := range []struct {
+		query string
+		exp   []string // sorted
+	}{
+		{"metal", []string{"lead: A soft metal."}},
+		{"heavy", nil},
+		{`"soft metal"`, []string{"lead: A soft metal."}},
+		{"metal -soft", nil},
+		{"striped", []string{"quagga: A striped animal, like a zebra."}},
+		{"paint OR hue", []string{"color: To paint.", "colour: A hue."}},
+	} {
+		rs, err := s.Search(c.query, 0)
+		if err != nil {
+			t.Errorf("search %q: %v", c.query, err)
+			continue
+		}
+		var ws []*Word
+		for _, r := range rs {
+			ws = append(ws, r.Word)
+		}
+		act := meanings(ws)
+		sort.Strings(act) // the scores for the base and the overlay aren't comparable
+		if !reflect.DeepEqual(act, c.exp) {
+			t.Errorf("search %q: expected %q, got %q", c.query, c.exp, act)
+		}
+	}
+
+	for _, c := range []struct {
+		description string
+		exp         []string
+	}{
+		{"a soft heavy metal", []string{"lead: A soft metal."}},
+		{"a striped animal", []string{"quagga: A striped animal, like a zebra."}},
+	} {
+		rs, err := s.Reverse(c.description, 0)
+		if err != nil {
+			t.Errorf("reverse %q: %v", c.description, err)
+			continue
+		}
+		var ws []*Word
+		for _, r := range rs {
+			ws = append(ws, r.Word)
+		}
+		if act := meanings(ws); !reflect.DeepEqual(act, c.exp) {
+			t.Errorf("reverse %q: expected %q, got %q", c.description, c.exp, act)
+		} else if rs[0].Meaning == nil || rs[0].Meaning.Text != ws[0].Meanings[0].Text {
+			t.Errorf("reverse %q: expected best meaning, got %+v", c.description, rs[0].Meaning)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"regexp"
 	"runtime/debug"
+	"sort"
 	"strings"
 
 	"github.com/pgaskin/dictutil/examples/webster1913-convert/webster1913"
@@ -12,7 +13,8 @@ import (
 // WordMap is an in-memory word Store used and returned by Parse. Although fast,
 // it consumes huge amounts of memory and shouldn't be used if possible. It is
 // up to the creator to ensure there aren't duplicate references to entries for
-// headwords.
+// headwords. To create a dict file without holding every entry in memory, use
+// Writer directly.
 type WordMap map[string][]*Word
 
 // HasWord implements Store.
@@ -36,6 +38,21 @@ func (wm WordMap) GetWord(word string) (*Word, bool, error) {
 	return ws[0], exists, err
 }
 
+// Headwords implements Iterator. Since the headwords need to be sorted, it
+// is relatively slow.
+func (wm WordMap) Headwords(start, prefix string) HeadwordIterator {
+	hws := make([]string, 0, len(wm))
+	for hw := range wm {
+		if hw >= start && strings.HasPrefix(hw, prefix) {
+			hws = append(hws, hw)
+		}
+	}
+	sort.Strings(hws)
+	return newSliceIterator(hws, start, prefix, func(headword string) ([]*Word, error) {
+		return wm[headword], nil
+	})
+}
+
 // NumWords implements Store.
 func (wm WordMap) NumWords() int {
 	return len(wm)
@@ -72,6 +89,7 @@ func Parse(r io.Reader) (WordMap, error) {
 		w.Word = e.Headword
 		w.Etymology = e.Etymology
 		w.Info = e.Info
+		parseInfo(w)
 		for _, d := range e.Meanings {
 			x := WordMeaning{
 				Text:    d.Text,
@@ -0,0 +1,209 @@
+package dictionary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Pattern is a wildcard pattern for headwords (e.g. for solving crosswords).
+// In a pattern, ? matches any single character, * matches any number of
+// characters, and [...] matches a single character in a set, which can
+// contain ranges (e.g. [a-z]), and is negated if it starts with ! or ^. All
+// other characters match themselves. Patterns and headwords are normalized in
+// the same way as for a Completer before matching.
+type Pattern struct {
+	toks   []patternToken
+	prefix string // literal prefix
+	min    int    // minimum length in characters
+	max    int    // maximum length in characters, or -1 if unbounded
+}
+
+type patternToken struct {
+	kind   patternKind
+	r      rune   // for patternLiteral
+	ranges []rune // pairs of inclusive ranges for patternSet
+	neg    bool   // for patternSet
+}
+
+type patternKind uint8
+
+const (
+	patternLiteral patternKind = iota
+	patternAny
+	patternStar
+	patternSet
+)
+
+// patternProtect replaces the brackets for sets with private use characters so
+// they aren't trimmed as punctuation by completeKey, and patternRestore puts
+// them back.
+var (
+	patternProtect = strings.NewReplacer("[", "\uE000", "]", "\uE001")
+	patternRestore = strings.NewReplacer("\uE000", "[", "\uE001", "]")
+)
+
+// ParsePattern parses and normalizes a Pattern.
+func ParsePattern(pattern string) (*Pattern, error) {
+	s := patternRestore.Replace(completeKey(patternProtect.Replace(pattern)))
+	if s == "" {
+		return nil, fmt.Errorf("invalid pattern: empty")
+	}
+
+	p := &Pattern{}
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		switch rs[i] {
+		case '?':
+			p.toks = append(p.toks, patternToken{kind: patternAny})
+		case '*':
+			if n := len(p.toks); n == 0 || p.toks[n-1].kind != patternStar {
+				p.toks = append(p.toks, patternToken{kind: patternStar})
+			}
+		case '[':
+			t := patternToken{kind: patternSet}
+			j := i + 1
+			if j < len(rs) && (rs[j] == '!' || rs[j] == '^') {
+				t.neg = true
+				j++
+			}
+			for ; j < len(rs) && (rs[j] != ']' || j == i+1 || (t.neg && j == i+2)); j++ {
+				if j+2 < len(rs) && rs[j+1] == '-' && rs[j+2] != ']' {
+					if rs[j] > rs[j+2] {
+						return nil, fmt.Errorf("invalid pattern: invalid range %c-%c", rs[j], rs[j+2])
+					}
+					t.ranges = append(t.ranges, rs[j], rs[j+2])
+					j += 2
+				} else {
+					t.ranges = append(t.ranges, rs[j], rs[j])
+				}
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("invalid pattern: unterminated [")
+			}
+			p.toks = append(p.toks, t)
+			i = j
+		default:
+			p.toks = append(p.toks, patternToken{kind: patternLiteral, r: rs[i]})
+		}
+	}
+
+	var prefix strings.Builder
+	literal := true
+	for _, t := range p.toks {
+		if t.kind != patternLiteral {
+			literal = false
+		} else if literal {
+			prefix.WriteRune(t.r)
+		}
+		if t.kind != patternStar {
+			p.min++
+		}
+	}
+	p.prefix = prefix.String()
+	p.max = p.min
+	for _, t := range p.toks {
+		if t.kind == patternStar {
+			p.max = -1
+			break
+		}
+	}
+	return p, nil
+}
+
+// Match checks if a headword matches the pattern.
+func (p *Pattern) Match(headword string) bool {
+	return p.match([]rune(completeKey(headword)))
+}
+
+// match matches a normalized headword against the pattern.
+func (p *Pattern) match(s []rune) bool {
+	if len(s) < p.min || (p.max >= 0 && len(s) > p.max) {
+		return false
+	}
+	// when a star fails to match, backtrack to the most recent one and let it
+	// consume one more character (earlier ones never need to be revisited)
+	ti, si := 0, 0
+	star, next := -1, 0
+	for si < len(s) {
+		if ti < len(p.toks) {
+			switch t := p.toks[ti]; t.kind {
+			case patternStar:
+				star, next = ti, si
+				ti++
+				continue
+			case patternAny:
+				ti++
+				si++
+				continue
+			case patternLiteral, patternSet:
+				if t.matchRune(s[si]) {
+					ti++
+					si++
+					continue
+				}
+			}
+		}
+		if star == -1 {
+			return false
+		}
+		next++
+		ti, si = star+1, next
+	}
+	for ti < len(p.toks) && p.toks[ti].kind == patternStar {
+		ti++
+	}
+	return ti == len(p.toks)
+}
+
+func (t patternToken) matchRune(r rune) bool {
+	if t.kind == patternLiteral {
+		return t.r == r
+	}
+	for i := 0; i < len(t.ranges); i += 2 {
+		if r >= t.ranges[i] && r <= t.ranges[i+1] {
+			return !t.neg
+		}
+	}
+	return t.neg
+}
+
+// Match returns up to n headwords which match the pattern in sorted order (by
+// their normalized form). If length is greater than zero, only headwords with
+// that many characters after normalization are returned. If filter is not nil,
+// only headwords for which it returns true are returned. If n is zero or less,
+// all of them are returned. Only the headwords with the literal prefix of the
+// pattern (if any) are checked.
+func (c *Completer) Match(p *Pattern, length, n int, filter func(headword string) bool) []string {
+	if length > 0 && (length < p.min || (p.max >= 0 && length > p.max)) {
+		return []string{}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := c.keys
+	i := sort.SearchStrings(keys, p.prefix)
+	keys = keys[:i+sort.Search(len(keys)-i, func(j int) bool {
+		return !strings.HasPrefix(keys[i+j], p.prefix)
+	})]
+
+	res := []string{}
+	for ; i < len(keys); i++ {
+		if n > 0 && len(res) == n {
+			break
+		}
+		if length > 0 && utf8.RuneCountInString(keys[i]) != length {
+			continue
+		}
+		if !p.match([]rune(keys[i])) {
+			continue
+		}
+		if filter != nil && !filter(c.hws[i]) {
+			continue
+		}
+		res = append(res, c.hws[i])
+	}
+	return res
+}
@@ -0,0 +1,316 @@
+package dictionary
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Reverser is implemented by Stores which can find entries from a description
+// of them (i.e. a reverse dictionary).
+type Reverser interface {
+	// Reverse returns up to n entries matching the description, best first. If
+	// n is zero or less, all of them are returned. If the Store does not have a
+	// text index, ErrNoTextIndex is returned.
+	Reverse(description string, n int) ([]ReverseResult, error)
+}
+
+// ReverseResult is an entry returned by Reverse.
+type ReverseResult struct {
+	Score   float64      `json:"score"`
+	Word    *Word        `json:"word"`
+	Meaning *WordMeaning `json:"meaning"` // the best matching meaning, or nil if only other text (e.g. the etymology) matched
+}
+
+// Reverse finds entries matching a description (e.g. "a curved structure
+// spanning an opening" for "arch"). Unlike Search, the entries only need to
+// contain some of the words in the description, and they are ranked using
+// BM25 on the words they contain. The words are normalized in the same way as
+// for Search, and common words (e.g. "the") are ignored. If store implements
+// Reverser and has a text index, it is used. Otherwise, the store must
+// implement Iterator, and every entry is read and scored, which is slow for
+// large Stores (so Reverser should be used directly if that isn't acceptable).
+func Reverse(store Store, description string, n int) ([]ReverseResult, error) {
+	res, err := reverseIndexed(store, description, n)
+	if errors.Is(err, ErrNoTextIndex) {
+		return reverseScan(store, description, n)
+	}
+	return res, err
+}
+
+// reverseIndexed is like Reverse, but returns ErrNoTextIndex rather than
+// reading every entry.
+func reverseIndexed(store Store, description string, n int) ([]ReverseResult, error) {
+	if r, ok := store.(Reverser); ok {
+		return r.Reverse(description, n)
+	}
+	return nil, ErrNoTextIndex
+}
+
+// Reverse implements Reverser. It requires the file to have been created with
+// Writer.EnableTextIndex.
+func (d *File) Reverse(description string, n int) ([]ReverseResult, error) {
+	if d.text == nil {
+		return nil, ErrNoTextIndex
+	}
+
+	terms := reverseTerms(description)
+	ps := make(map[string][]textPosting, len(terms))
+	idfs := make(map[string]float64, len(terms))
+	var cands []uint32
+	for _, term := range terms {
+		p, err := d.text.lookup(term)
+		if err != nil {
+			return nil, formatErr("text index", -1, ErrMalformed, err)
+		}
+		ps[term], idfs[term] = p, bm25idf(len(p), d.text.ndocs)
+		cands = unionDocs(cands, textDocs(p))
+	}
+
+	scores, err := d.text.score(cands, terms, func(term string) ([]textPosting, error) {
+		return ps[term], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if si, sj := scores[cands[i]], scores[cands[j]]; si != sj {
+			return si > sj
+		}
+		return cands[i] < cands[j]
+	})
+	if n > 0 && len(cands) > n {
+		cands = cands[:n]
+	}
+
+	res := make([]ReverseResult, len(cands))
+	for i, doc := range cands {
+		cur, _ := d.text.doc(doc)
+		w, err := d.get(cur)
+		if err != nil {
+			return nil, fmt.Errorf("get result %d: %w", cur, err)
+		}
+		res[i] = ReverseResult{scores[doc], w, bestMeaning(w, idfs)}
+	}
+	return res, nil
+}
+
+// Reverse implements Reverser by merging the results from each Store, removing
+// entries which are duplicates of ones in a Store with a higher priority. Since
+// the scores are calculated separately for each Store, they may not be
+// directly comparable. Stores without a text index are skipped.
+func (ms *MultiStore) Reverse(description string, n int) ([]ReverseResult, error) {
+	var res []ReverseResult
+	var found bool
+	for i, s := range ms.stores {
+		rs, err := reverseIndexed(s, description, n)
+		if errors.Is(err, ErrNoTextIndex) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("store %d: %w", i, err)
+		}
+		found = true
+		for _, r := range rs {
+			if dup, err := ms.isDuplicate(i, r.Word); err != nil {
+				return nil, err
+			} else if !dup {
+				res = append(res, r)
+			}
+		}
+	}
+	if !found {
+		return nil, ErrNoTextIndex
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+// Reverse implements Reverser using the base Store, removing entries for
+// headwords which were replaced or hidden by the overlay, and adding the
+// matching entries from the overlay itself. Since the overlay doesn't have a
+// text index, its entries are scored separately, so the scores may not be
+// directly comparable.
+func (s *OverlayStore) Reverse(description string, n int) ([]ReverseResult, error) {
+	m := n
+	if m > 0 {
+		m += len(s.ov.Headwords())
+	}
+	rs, err := reverseIndexed(s.base, description, m)
+	if err != nil {
+		return nil, err
+	}
+	res := rs[:0]
+	for _, r := range rs {
+		if !s.isReplaced(r.Word) {
+			res = append(res, r)
+		}
+	}
+	if terms := reverseTerms(description); len(terms) != 0 {
+		ors, idfs, err := scanScores(s.ov.words(), terms)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range ors {
+			r.Meaning = bestMeaning(r.Word, idfs)
+			res = append(res, r)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+// reverseScan implements Reverse by reading every entry in a Store. Entries
+// are only counted under their primary headword.
+func reverseScan(store Store, description string, n int) ([]ReverseResult, error) {
+	terms := reverseTerms(description)
+	if len(terms) == 0 {
+		return []ReverseResult{}, nil
+	}
+
+	res, idfs, err := scanScores(store, terms)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	for i := range res {
+		res[i].Meaning = bestMeaning(res[i].Word, idfs)
+	}
+	return res, nil
+}
+
+// scanScores reads every entry in a Store, and scores the ones containing any
+// of the terms using BM25. The idf of each term is also returned. Entries are
+// only counted under their primary headword.
+func scanScores(store Store, terms []string) ([]ReverseResult, map[string]float64, error) {
+	it, err := Headwords(store, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type doc struct {
+		w   *Word
+		tfs []uint32
+		dl  uint32
+	}
+	var docs []doc
+	var ndocs int
+	var ntokens int64
+	dfs := make([]int, len(terms))
+	stems := map[string]string{}
+	for it.Next() {
+		ws, err := it.Words()
+		if err != nil {
+			return nil, nil, fmt.Errorf("get %q: %w", it.Headword(), err)
+		}
+		for _, w := range ws {
+			if w.Word != it.Headword() && store.HasWord(w.Word) {
+				continue
+			}
+			d := doc{w: w, tfs: make([]uint32, len(terms))}
+			var matched bool
+			for _, f := range textFields(w) {
+				for _, t := range textTerms(f, stems) {
+					for i, term := range terms {
+						if t == term {
+							d.tfs[i]++
+							matched = true
+						}
+					}
+					d.dl++
+				}
+			}
+			ndocs++
+			ntokens += int64(d.dl)
+			if matched {
+				for i, tf := range d.tfs {
+					if tf != 0 {
+						dfs[i]++
+					}
+				}
+				docs = append(docs, d)
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	avgdl := float64(ntokens) / math.Max(float64(ndocs), 1)
+	idfs := make(map[string]float64, len(terms))
+	for i, term := range terms {
+		idfs[term] = bm25idf(dfs[i], ndocs)
+	}
+
+	res := make([]ReverseResult, len(docs))
+	for i, d := range docs {
+		var score float64
+		for j, tf := range d.tfs {
+			if tf != 0 {
+				score += bm25(idfs[terms[j]], tf, d.dl, avgdl)
+			}
+		}
+		res[i] = ReverseResult{Score: score, Word: d.w}
+	}
+	return res, idfs, nil
+}
+
+// reverseStopWords are the terms for common words, which are ignored in
+// descriptions since nearly every entry contains them.
+var reverseStopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields("a an and any are as at be by for from in into is it its of on or that the this to was which with") {
+		reverseStopWords[textTerm(w, nil)] = true
+	}
+}
+
+// reverseTerms returns the unique terms in a description, without stop words.
+func reverseTerms(description string) []string {
+	var terms []string
+	for _, t := range uniqueStrings(textTerms(description, nil)) {
+		if !reverseStopWords[t] {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// bestMeaning returns the meaning of w which contains the most important terms
+// (by the sum of their idf), or nil if none of them contain any.
+func bestMeaning(w *Word, idfs map[string]float64) *WordMeaning {
+	var best *WordMeaning
+	var bestScore float64
+	for i, m := range w.Meanings {
+		var score float64
+		seen := map[string]bool{}
+		for _, f := range []string{m.Text, m.Example} {
+			for _, t := range textTerms(f, nil) {
+				if idf, ok := idfs[t]; ok && !seen[t] {
+					seen[t] = true
+					score += idf
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = &w.Meanings[i], score
+		}
+	}
+	return best
+}
@@ -0,0 +1,498 @@
+package dictionary
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrNoTextIndex is returned by Search if a Store does not have a text index.
+var ErrNoTextIndex = errors.New("no text index")
+
+// Searcher is implemented by Stores which support full-text search of the text
+// of their entries (the meanings, examples, etymology and notes).
+//
+// Queries consist of words and quoted phrases. Entries must match all of them,
+// unless they are separated by OR, in which case they must match any of them.
+// Words and phrases prefixed by - or NOT must not match. For example:
+//
+//   rainbow "of light" OR spectrum -arch
+//
+// The words are lowercased, folded, and stemmed, so "Rainbows" matches
+// "rainbow". Results are ranked using BM25.
+type Searcher interface {
+	// Search returns up to n entries matching the query, best first. If n is
+	// zero or less, all of them are returned. If the Store does not have a
+	// text index, ErrNoTextIndex is returned.
+	Search(query string, n int) ([]SearchResult, error)
+}
+
+// SearchResult is an entry returned by Search.
+type SearchResult struct {
+	Score float64 `json:"score"`
+	Word  *Word   `json:"word"`
+}
+
+// Search searches the entries in a Store. If it does not implement Searcher,
+// ErrNoTextIndex is returned.
+func Search(store Store, query string, n int) ([]SearchResult, error) {
+	if s, ok := store.(Searcher); ok {
+		return s.Search(query, n)
+	}
+	return nil, ErrNoTextIndex
+}
+
+// Search implements Searcher. It requires the file to have been created with
+// Writer.EnableTextIndex.
+func (d *File) Search(query string, n int) ([]SearchResult, error) {
+	if d.text == nil {
+		return nil, ErrNoTextIndex
+	}
+
+	q := parseTextQuery(query)
+	if len(q.groups) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	ps := map[string][]textPosting{}
+	get := func(term string) ([]textPosting, error) {
+		if p, ok := ps[term]; ok {
+			return p, nil
+		}
+		p, err := d.text.lookup(term)
+		if err != nil {
+			return nil, formatErr("text index", -1, ErrMalformed, err)
+		}
+		ps[term] = p
+		return p, nil
+	}
+	docs := func(c textClause) ([]uint32, error) {
+		var res []uint32
+		for i, term := range c.terms {
+			p, err := get(term)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				res = textDocs(p)
+			} else {
+				res = intersectDocs(res, textDocs(p))
+			}
+		}
+		return res, nil
+	}
+
+	// find the candidates
+	var cands []uint32
+	for i, g := range q.groups {
+		var set []uint32
+		for _, c := range g {
+			cs, err := docs(c)
+			if err != nil {
+				return nil, err
+			}
+			set = unionDocs(set, cs)
+		}
+		if i == 0 {
+			cands = set
+		} else {
+			cands = intersectDocs(cands, set)
+		}
+	}
+	for _, c := range q.exclude {
+		if !c.phrase { // phrases are checked later
+			cs, err := docs(c)
+			if err != nil {
+				return nil, err
+			}
+			cands = subtractDocs(cands, cs)
+		}
+	}
+
+	// rank them
+	var terms []string
+	for _, g := range q.groups {
+		for _, c := range g {
+			terms = append(terms, c.terms...)
+		}
+	}
+	scores, err := d.text.score(cands, uniqueStrings(terms), get)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if si, sj := scores[cands[i]], scores[cands[j]]; si != sj {
+			return si > sj
+		}
+		return cands[i] < cands[j]
+	})
+
+	// read the entries and check the phrases
+	res := []SearchResult{}
+	for _, doc := range cands {
+		if n > 0 && len(res) >= n {
+			break
+		}
+		cur, _ := d.text.doc(doc)
+		w, err := d.get(cur)
+		if err != nil {
+			return nil, fmt.Errorf("get result %d: %w", cur, err)
+		}
+		if q.phrases && !q.match(w) {
+			continue
+		}
+		res = append(res, SearchResult{scores[doc], w})
+	}
+	return res, nil
+}
+
+// Search implements Searcher by merging the results from each Store which
+// supports it, removing entries which are duplicates of ones in a Store with a
+// higher priority. Since the scores are calculated separately for each Store,
+// they may not be directly comparable.
+func (ms *MultiStore) Search(query string, n int) ([]SearchResult, error) {
+	var res []SearchResult
+	var found bool
+	for i, s := range ms.stores {
+		rs, err := Search(s, query, n)
+		if errors.Is(err, ErrNoTextIndex) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("store %d: %w", i, err)
+		}
+		found = true
+		for _, r := range rs {
+			if dup, err := ms.isDuplicate(i, r.Word); err != nil {
+				return nil, err
+			} else if !dup {
+				res = append(res, r)
+			}
+		}
+	}
+	if !found {
+		return nil, ErrNoTextIndex
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+// Search implements Searcher by searching the base Store, removing entries for
+// headwords which were replaced or hidden by the overlay, and adding the
+// matching entries from the overlay itself. Since the overlay doesn't have a
+// text index, its entries are scored separately, so the scores may not be
+// directly comparable.
+func (s *OverlayStore) Search(query string, n int) ([]SearchResult, error) {
+	m := n
+	if m > 0 {
+		m += len(s.ov.Headwords())
+	}
+	rs, err := Search(s.base, query, m)
+	if err != nil {
+		return nil, err
+	}
+	res := rs[:0]
+	for _, r := range rs {
+		if !s.isReplaced(r.Word) {
+			res = append(res, r)
+		}
+	}
+
+	q := parseTextQuery(query)
+	var terms []string
+	for _, g := range q.groups {
+		for _, c := range g {
+			terms = append(terms, c.terms...)
+		}
+	}
+	if len(terms) != 0 {
+		ors, _, err := scanScores(s.ov.words(), uniqueStrings(terms))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range ors {
+			if q.match(r.Word) {
+				res = append(res, SearchResult{r.Score, r.Word})
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+// isDuplicate checks if w, from the Store at index i, is a duplicate of an
+// entry for the same headword in a Store with a higher priority.
+func (ms *MultiStore) isDuplicate(i int, w *Word) (bool, error) {
+	for j, s := range ms.stores[:i] {
+		ws, _, err := s.GetWords(w.Word)
+		if err != nil {
+			return false, fmt.Errorf("store %d: %w", j, err)
+		}
+		for _, x := range ws {
+			if ms.dedupe(x, w) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// isReplaced checks if w, from the base Store, was replaced or hidden by the
+// overlay.
+func (s *OverlayStore) isReplaced(w *Word) bool {
+	e, ok := s.ov.Get(w.Word)
+	return ok && e.Action != OverlayAdd
+}
+
+// score calculates the BM25 scores of documents for a set of terms.
+func (t *textIndex) score(docs []uint32, terms []string, get func(term string) ([]textPosting, error)) (map[uint32]float64, error) {
+	avgdl := float64(t.ntokens) / math.Max(float64(t.ndocs), 1)
+
+	scores := make(map[uint32]float64, len(docs))
+	for _, term := range terms {
+		ps, err := get(term)
+		if err != nil {
+			return nil, err
+		} else if len(ps) == 0 {
+			continue
+		}
+		idf := bm25idf(len(ps), t.ndocs)
+		for _, doc := range docs {
+			i := sort.Search(len(ps), func(i int) bool {
+				return ps[i].doc >= doc
+			})
+			if i == len(ps) || ps[i].doc != doc {
+				continue
+			}
+			_, dl := t.doc(doc)
+			scores[doc] += bm25(idf, ps[i].tf, dl, avgdl)
+		}
+	}
+	return scores, nil
+}
+
+// bm25idf calculates the inverse document frequency of a term in df of n
+// documents.
+func bm25idf(df, n int) float64 {
+	return math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// bm25 calculates the BM25 score of a term which occurs tf times in a document
+// with dl terms.
+func bm25(idf float64, tf, dl uint32, avgdl float64) float64 {
+	const k1, b = 1.2, 0.75
+	return idf * float64(tf) * (k1 + 1) / (float64(tf) + k1*(1-b+b*float64(dl)/math.Max(avgdl, 1)))
+}
+
+// textQuery is a parsed search query.
+type textQuery struct {
+	groups  [][]textClause // each must match one of the clauses
+	exclude []textClause   // none must match
+	phrases bool           // whether there are any phrases
+}
+
+// textClause is a word or phrase in a query.
+type textClause struct {
+	terms  []string
+	phrase bool // whether the terms must be consecutive
+}
+
+// parseTextQuery parses a search query. Words without any terms are ignored.
+func parseTextQuery(query string) textQuery {
+	var q textQuery
+	var or, not bool
+	for s := strings.TrimSpace(query); s != ""; s = strings.TrimLeftFunc(s, unicode.IsSpace) {
+		var neg bool
+		if s[0] == '-' && len(s) > 1 && !unicode.IsSpace(rune(s[1])) {
+			neg, s = true, s[1:]
+		}
+
+		var text string
+		if s[0] == '"' {
+			if i := strings.IndexByte(s[1:], '"'); i != -1 {
+				text, s = s[1:i+1], s[i+2:]
+			} else {
+				text, s = s[1:], ""
+			}
+		} else {
+			if i := strings.IndexFunc(s, unicode.IsSpace); i != -1 {
+				text, s = s[:i], s[i:]
+			} else {
+				text, s = s, ""
+			}
+			if !neg {
+				switch text {
+				case "AND":
+					continue
+				case "OR":
+					or = len(q.groups) != 0
+					continue
+				case "NOT":
+					not = true
+					continue
+				}
+			}
+		}
+
+		// words like "self-command" are also phrases
+		c := textClause{terms: textTerms(text, nil)}
+		c.phrase = len(c.terms) > 1
+		if len(c.terms) == 0 {
+			or, not = false, false
+			continue
+		}
+		q.phrases = q.phrases || c.phrase
+		switch {
+		case neg || not:
+			q.exclude = append(q.exclude, c)
+		case or:
+			q.groups[len(q.groups)-1] = append(q.groups[len(q.groups)-1], c)
+		default:
+			q.groups = append(q.groups, []textClause{c})
+		}
+		or, not = false, false
+	}
+	return q
+}
+
+// match checks if a word matches the query.
+func (q textQuery) match(w *Word) bool {
+	var fields [][]string
+	for _, f := range textFields(w) {
+		fields = append(fields, textTerms(f, nil))
+	}
+	for _, g := range q.groups {
+		var ok bool
+		for _, c := range g {
+			if ok = c.match(fields); ok {
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for _, c := range q.exclude {
+		if c.match(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+// match checks if the terms of each field match the clause.
+func (c textClause) match(fields [][]string) bool {
+	if !c.phrase {
+	terms:
+		for _, term := range c.terms {
+			for _, f := range fields {
+				for _, x := range f {
+					if x == term {
+						continue terms
+					}
+				}
+			}
+			return false
+		}
+		return true
+	}
+	for _, f := range fields {
+	start:
+		for i := 0; i+len(c.terms) <= len(f); i++ {
+			for j, term := range c.terms {
+				if f[i+j] != term {
+					continue start
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func textDocs(ps []textPosting) []uint32 {
+	docs := make([]uint32, len(ps))
+	for i, p := range ps {
+		docs[i] = p.doc
+	}
+	return docs
+}
+
+// intersectDocs returns the documents in both sorted lists.
+func intersectDocs(a, b []uint32) []uint32 {
+	res := []uint32{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+// unionDocs returns the documents in either sorted list.
+func unionDocs(a, b []uint32) []uint32 {
+	res := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			res = append(res, a[i])
+			i++
+		case a[i] > b[j]:
+			res = append(res, b[j])
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+	res = append(res, a[i:]...)
+	return append(res, b[j:]...)
+}
+
+// subtractDocs returns the documents in the sorted list a which aren't in b.
+func subtractDocs(a, b []uint32) []uint32 {
+	res := []uint32{}
+	j := 0
+	for _, doc := range a {
+		for j < len(b) && b[j] < doc {
+			j++
+		}
+		if j == len(b) || b[j] != doc {
+			res = append(res, doc)
+		}
+	}
+	return res
+}
+
+func uniqueStrings(s []string) []string {
+	seen := map[string]bool{}
+	res := s[:0:0]
+	for _, x := range s {
+		if !seen[x] {
+			seen[x] = true
+			res = append(res, x)
+		}
+	}
+	return res
+}
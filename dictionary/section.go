@@ -0,0 +1,118 @@
+package dictionary
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Section tags for DICT8 files.
+const (
+	sectionData = "DATA" // records
+	sectionIdx  = "INDX" // key table of headwords to []offset
+	sectionMeta = "META" // Metadata msgpack
+	sectionText = "TEXT" // textIndex (optional)
+	sectionInfl = "INFL" // key table of inflected forms to []offset (optional)
+)
+
+// fileSections is the number of section slots reserved in the header of new
+// files. Readers use the count stored in the file.
+const fileSections = 8
+
+// maxSections is the maximum number of section slots a reader will accept.
+const maxSections = 64
+
+var (
+	crcw     = int64(crc32.Size)
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// section is an entry in the section table of a DICT8 file.
+type section struct {
+	Tag    [4]byte
+	Offset int64
+	Size   int64
+	Sum    [sha256.Size]byte
+}
+
+var sectionw = int64(binary.Size(section{}))
+
+// Name returns the section tag as a string.
+func (s section) Name() string {
+	return string(s.Tag[:])
+}
+
+// verify checks the sha256 of the section.
+func (s section) verify(r io.ReaderAt) error {
+	h := sha256.New()
+	if n, err := io.Copy(h, io.NewSectionReader(r, s.Offset, s.Size)); err != nil {
+		return fmt.Errorf("could not read section: %v", err)
+	} else if n != s.Size {
+		return fmt.Errorf("could not read section: truncated to %d bytes", n)
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, s.Sum[:]) {
+		return fmt.Errorf("digest mismatch (expected %x, got %x)", s.Sum, sum)
+	}
+	return nil
+}
+
+// verifyBytes is like verify, but for a section which has already been read
+// into b.
+func (s section) verifyBytes(b []byte) error {
+	if sum := sha256.Sum256(b); sum != s.Sum {
+		return fmt.Errorf("digest mismatch (expected %x, got %x)", s.Sum, sum)
+	}
+	return nil
+}
+
+// readSections reads the section table after the FileVer, and checks the
+// sections are within the file, which is sz bytes long. Unused slots are not
+// returned.
+func readSections(r io.Reader, sz int64) ([]section, error) {
+	var n size
+	if err := (&n).Read(r); err != nil {
+		return nil, fmt.Errorf("could not read section count: %w", err)
+	} else if n < 0 || n > maxSections {
+		return nil, formatErr("section table", int64(len(FileVer)), ErrMalformed, fmt.Errorf("invalid section count %d", n))
+	}
+	hdr := int64(len(FileVer)) + sizew + int64(n)*sectionw
+	if hdr > sz {
+		return nil, formatErr("section table", int64(len(FileVer)), ErrOutOfBounds, fmt.Errorf("file is only %d bytes", sz))
+	}
+	secs := make([]section, n)
+	if err := binary.Read(r, binary.LittleEndian, secs); err != nil {
+		return nil, fmt.Errorf("could not read sections: %w", err)
+	}
+	var res []section
+	for _, s := range secs {
+		if s.Tag != [4]byte{} {
+			if s.Offset < hdr || s.Size < 0 || s.Offset > sz || s.Size > sz-s.Offset {
+				return nil, formatErr("section table", int64(len(FileVer)), ErrOutOfBounds, fmt.Errorf("section %s (%d+%d) not within %d-%d", s.Name(), s.Offset, s.Size, hdr, sz))
+			}
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+// writeSections writes a section table with fileSections slots.
+func writeSections(w io.Writer, secs []section) error {
+	if len(secs) > fileSections {
+		panic("bug: too many sections")
+	}
+	if err := size(fileSections).Write(w); err != nil {
+		return err
+	}
+	slots := make([]section, fileSections)
+	copy(slots, secs)
+	return binary.Write(w, binary.LittleEndian, slots)
+}
+
+// sectionHeaderSize is the size of the FileVer and the section table in new
+// files.
+func sectionHeaderSize() int64 {
+	return int64(len(FileVer)) + sizew + fileSections*sectionw
+}
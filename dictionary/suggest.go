@@ -0,0 +1,292 @@
+package dictionary
+
+import (
+	"sort"
+	"sync"
+)
+
+// Suggester is implemented by Stores (or indexes for them) which can suggest
+// headwords similar to a word which does not exist (e.g. a misspelling).
+type Suggester interface {
+	// Suggest returns up to n headwords similar to word, most similar first. If
+	// n is zero or less, all of them are returned.
+	Suggest(word string, n int) ([]string, error)
+}
+
+// Suggest suggests headwords similar to word, most similar first. The words
+// are normalized the same way as for a Completer, and compared by their edit
+// distance (with transpositions of adjacent characters counting as a single
+// edit). If store implements Suggester, it is used. Otherwise, the store
+// must implement Iterator, and every headword is compared, so a SuggestIndex
+// should be used if suggestions are needed more than once.
+func Suggest(store Store, word string, n int) ([]string, error) {
+	if s, ok := store.(Suggester); ok {
+		return s.Suggest(word, n)
+	}
+
+	it, err := Headwords(store, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	key := []rune(completeKey(word))
+	max := suggestMaxDist(len(key))
+	var ss []suggestion
+	for it.Next() {
+		hw := it.Headword()
+		hk := []rune(completeKey(hw))
+		if editDistance(key, hk, max+1) <= max+1 {
+			if d := osaDistance(key, hk); d <= max {
+				ss = append(ss, newSuggestion(hw, hk, key, d))
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return suggestions(ss, n), nil
+}
+
+// SuggestIndex implements Suggester using a BK-tree of the headwords in a
+// Store, which only needs to compare a small part of the headwords for each
+// suggestion. It is safe for concurrent use.
+type SuggestIndex struct {
+	store Store
+
+	mu   sync.RWMutex
+	root *bkNode
+}
+
+// bkNode is a node in a BK-tree. Each child is at a unique edit distance from
+// the node.
+type bkNode struct {
+	key      []rune
+	hws      []string // the headwords which normalize to key
+	children []bkChild
+}
+
+type bkChild struct {
+	dist int
+	node *bkNode
+}
+
+// NewSuggestIndex builds a SuggestIndex for the headwords in a Store, which
+// must implement Iterator.
+func NewSuggestIndex(store Store) (*SuggestIndex, error) {
+	s := &SuggestIndex{store: store}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload rebuilds the index from the Store (e.g. after an Overlay changes).
+func (s *SuggestIndex) Reload() error {
+	it, err := Headwords(s.store, "", "")
+	if err != nil {
+		return err
+	}
+
+	var root *bkNode
+	for it.Next() {
+		hw := it.Headword()
+		key := []rune(completeKey(hw))
+		if root == nil {
+			root = &bkNode{key: key, hws: []string{hw}}
+			continue
+		}
+	insert:
+		for node := root; ; {
+			d := editDistance(key, node.key, -1)
+			if d == 0 {
+				node.hws = append(node.hws, hw)
+				break
+			}
+			for _, c := range node.children {
+				if c.dist == d {
+					node = c.node
+					continue insert
+				}
+			}
+			node.children = append(node.children, bkChild{d, &bkNode{key: key, hws: []string{hw}}})
+			break
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.root = root
+	s.mu.Unlock()
+	return nil
+}
+
+// Suggest implements Suggester.
+func (s *SuggestIndex) Suggest(word string, n int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := []rune(completeKey(word))
+	max := suggestMaxDist(len(key))
+	var ss []suggestion
+	if s.root != nil {
+		stack := []*bkNode{s.root}
+		for len(stack) != 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			// the tree uses the Levenshtein distance, since it needs to be a
+			// metric, so search for one more than max to allow for a
+			// transposition (which is two edits without them)
+			d := editDistance(key, node.key, -1)
+			if d <= max+1 {
+				if d := osaDistance(key, node.key); d <= max {
+					for _, hw := range node.hws {
+						ss = append(ss, newSuggestion(hw, node.key, key, d))
+					}
+				}
+			}
+			// by the triangle inequality, matches can only be under children
+			// within max+1 of d
+			for _, c := range node.children {
+				if c.dist >= d-max-1 && c.dist <= d+max+1 {
+					stack = append(stack, c.node)
+				}
+			}
+		}
+	}
+	return suggestions(ss, n), nil
+}
+
+// suggestMaxDist returns the maximum edit distance for suggestions for a word
+// with n characters.
+func suggestMaxDist(n int) int {
+	if n <= 4 {
+		return 1
+	}
+	return 2
+}
+
+type suggestion struct {
+	hw    string
+	key   string
+	dist  int // edit distance
+	ldiff int // difference in length
+}
+
+func newSuggestion(hw string, key, word []rune, dist int) suggestion {
+	ldiff := len(key) - len(word)
+	if ldiff < 0 {
+		ldiff = -ldiff
+	}
+	return suggestion{hw, string(key), dist, ldiff}
+}
+
+// suggestions sorts suggestions by distance, then by the difference in length
+// from the word, then by key, and returns up to n headwords.
+func suggestions(ss []suggestion, n int) []string {
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].dist != ss[j].dist {
+			return ss[i].dist < ss[j].dist
+		}
+		if ss[i].ldiff != ss[j].ldiff {
+			return ss[i].ldiff < ss[j].ldiff
+		}
+		if ss[i].key != ss[j].key {
+			return ss[i].key < ss[j].key
+		}
+		return ss[i].hw < ss[j].hw
+	})
+	if n > 0 && len(ss) > n {
+		ss = ss[:n]
+	}
+	res := make([]string, len(ss))
+	for i, s := range ss {
+		res[i] = s.hw
+	}
+	return res
+}
+
+// editDistance returns the Levenshtein distance between a and b. If max is not
+// negative, it may stop early and return a value greater than max if the
+// distance is greater than max.
+func editDistance(a, b []rune, max int) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	if max >= 0 && len(a)-len(b) > max {
+		return max + 1
+	}
+
+	var buf [2 * 32]int // avoid allocating for most words
+	var prev, cur []int
+	if len(b) < 32 {
+		prev, cur = buf[:len(b)+1], buf[32:32+len(b)+1]
+	} else {
+		prev, cur = make([]int, len(b)+1), make([]int, len(b)+1)
+	}
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		min := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if v := prev[j] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if v := cur[j-1] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if cur[j] < min {
+				min = cur[j]
+			}
+		}
+		if max >= 0 && min > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// osaDistance returns the optimal string alignment distance between a and b,
+// which is like the Levenshtein distance, but also allows transpositions of
+// adjacent characters (as long as they aren't edited again).
+func osaDistance(a, b []rune) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if v := d[i-1][j] + 1; v < d[i][j] {
+				d[i][j] = v
+			}
+			if v := d[i][j-1] + 1; v < d[i][j] {
+				d[i][j] = v
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				if v := d[i-2][j-2] + 1; v < d[i][j] {
+					d[i][j] = v
+				}
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
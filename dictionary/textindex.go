@@ -0,0 +1,267 @@
+package dictionary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kljensen/snowball"
+)
+
+// textIndex is an inverted index of the text of the entries in a dict file,
+// which is stored in the TEXT section. Each record is a document.
+//
+// It is encoded as follows:
+//
+//   + ------- + --------- + ---------------- + ---------------- + -------- + ------- + -------- +
+//   |  ndocs  |  ntokens  |  doc offset ...  |  doc length ...  |  ntable  |  terms  | postings |
+//   + ------- + --------- + ---------------- + ---------------- + -------- + ------- + -------- +
+//
+//   The ndocs, ntokens, doc offsets and ntable are little-endian int64, and the
+//   doc lengths (the number of tokens in each document) are little-endian
+//   uint32. The terms are a key table (of size ntable) of terms to the number
+//   of documents containing them and the offset of their postings relative to
+//   the start of the postings. The postings for each term are a list of
+//   uvarint pairs of the document number (relative to the previous one) and
+//   the number of times the term occurs in it.
+//
+// The text is split into terms by textTerms, and the positions of the terms
+// are not stored, so phrases need to be checked against the entries
+// themselves.
+type textIndex struct {
+	ndocs    int
+	ntokens  int64
+	offs     []byte // ndocs * sizew
+	lens     []byte // ndocs * 4
+	terms    *keyTable
+	postings []byte
+}
+
+// parseTextIndex parses an encoded text index. It does not copy b.
+func parseTextIndex(b []byte) (*textIndex, error) {
+	if int64(len(b)) < sizew*2 {
+		return nil, fmt.Errorf("text index too short")
+	}
+	ndocs := int64(binary.LittleEndian.Uint64(b))
+	ntokens := int64(binary.LittleEndian.Uint64(b[sizew:]))
+	b = b[sizew*2:]
+	if ndocs < 0 || ntokens < 0 || ndocs > int64(len(b))/(sizew+4) {
+		return nil, fmt.Errorf("invalid text index header (ndocs=%d, ntokens=%d)", ndocs, ntokens)
+	}
+	t := &textIndex{
+		ndocs:   int(ndocs),
+		ntokens: ntokens,
+		offs:    b[:ndocs*sizew],
+		lens:    b[ndocs*sizew : ndocs*(sizew+4)],
+	}
+	b = b[ndocs*(sizew+4):]
+	if int64(len(b)) < sizew {
+		return nil, fmt.Errorf("text index too short for term table")
+	}
+	ntable := int64(binary.LittleEndian.Uint64(b))
+	b = b[sizew:]
+	if ntable < 0 || ntable > int64(len(b)) {
+		return nil, fmt.Errorf("invalid term table size %d", ntable)
+	}
+	terms, err := parseKeyTable(b[:ntable])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse term table: %v", err)
+	}
+	t.terms, t.postings = terms, b[ntable:]
+	return t, nil
+}
+
+// doc gets the record offset and length of a document.
+func (t *textIndex) doc(i uint32) (size, uint32) {
+	return size(binary.LittleEndian.Uint64(t.offs[int64(i)*sizew:])), binary.LittleEndian.Uint32(t.lens[i*4:])
+}
+
+// textPosting is a document containing a term.
+type textPosting struct {
+	doc uint32
+	tf  uint32
+}
+
+// lookup gets the postings for a term in order of document number.
+func (t *textIndex) lookup(term string) ([]textPosting, error) {
+	vals, ok, err := t.terms.Get(term)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, nil
+	} else if len(vals) != 2 {
+		return nil, fmt.Errorf("term %q: invalid value count %d", term, len(vals))
+	}
+
+	df, off := vals[0], vals[1]
+	if df > uint64(t.ndocs) || off > uint64(len(t.postings)) {
+		return nil, fmt.Errorf("term %q: postings out of range", term)
+	}
+
+	r := keyTableReader{b: t.postings, off: int(off)}
+	ps := make([]textPosting, df)
+	var doc uint64
+	for i := range ps {
+		doc += r.uvarint()
+		tf := r.uvarint()
+		if r.err == nil && (doc >= uint64(t.ndocs) || (i != 0 && doc == uint64(ps[i-1].doc)) || tf > 1<<32-1) {
+			r.err = fmt.Errorf("invalid posting %d", i)
+		}
+		ps[i] = textPosting{uint32(doc), uint32(tf)}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("term %q: %v", term, r.err)
+	}
+	return ps, nil
+}
+
+// textIndexBuilder builds a textIndex.
+type textIndexBuilder struct {
+	offs    []uint64
+	lens    []uint32
+	ntokens int64
+	terms   map[string]*textIndexTerm
+	stems   map[string]string // cache
+}
+
+type textIndexTerm struct {
+	docs []uint32
+	tfs  []uint32
+}
+
+func newTextIndexBuilder() *textIndexBuilder {
+	return &textIndexBuilder{
+		terms: map[string]*textIndexTerm{},
+		stems: map[string]string{},
+	}
+}
+
+// add adds a record to the index.
+func (b *textIndexBuilder) add(cur size, w *Word) {
+	doc := uint32(len(b.offs))
+	tfs := map[string]uint32{}
+	var n uint32
+	for _, f := range textFields(w) {
+		for _, term := range textTerms(f, b.stems) {
+			tfs[term]++
+			n++
+		}
+	}
+	for term, tf := range tfs {
+		t, ok := b.terms[term]
+		if !ok {
+			t = &textIndexTerm{}
+			b.terms[term] = t
+		}
+		t.docs = append(t.docs, doc)
+		t.tfs = append(t.tfs, tf)
+	}
+	b.offs = append(b.offs, uint64(cur))
+	b.lens = append(b.lens, n)
+	b.ntokens += int64(n)
+}
+
+// encode encodes the index.
+func (b *textIndexBuilder) encode() []byte {
+	terms := make([]string, 0, len(b.terms))
+	for term := range b.terms {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	var postings []byte
+	var tmp [binary.MaxVarintLen64]byte
+	table := make(map[string][]uint64, len(terms))
+	for _, term := range terms {
+		t := b.terms[term]
+		table[term] = []uint64{uint64(len(t.docs)), uint64(len(postings))}
+		var prev uint32
+		for i, doc := range t.docs {
+			postings = append(postings, tmp[:binary.PutUvarint(tmp[:], uint64(doc-prev))]...)
+			postings = append(postings, tmp[:binary.PutUvarint(tmp[:], uint64(t.tfs[i]))]...)
+			prev = doc
+		}
+	}
+	tb := encodeKeyTable(table)
+
+	buf := make([]byte, sizew*2, sizew*2+int64(len(b.offs))*(sizew+4)+sizew+int64(len(tb))+int64(len(postings)))
+	binary.LittleEndian.PutUint64(buf, uint64(len(b.offs)))
+	binary.LittleEndian.PutUint64(buf[sizew:], uint64(b.ntokens))
+	for _, off := range b.offs {
+		buf = append(buf, tmp[:8]...)
+		binary.LittleEndian.PutUint64(buf[len(buf)-8:], off)
+	}
+	for _, n := range b.lens {
+		buf = append(buf, tmp[:4]...)
+		binary.LittleEndian.PutUint32(buf[len(buf)-4:], n)
+	}
+	buf = append(buf, tmp[:8]...)
+	binary.LittleEndian.PutUint64(buf[len(buf)-8:], uint64(len(tb)))
+	buf = append(buf, tb...)
+	buf = append(buf, postings...)
+	return buf
+}
+
+// textFields returns the text of a word which is indexed.
+func textFields(w *Word) []string {
+	fs := make([]string, 0, len(w.Meanings)*2+len(w.Notes)+1)
+	for _, m := range w.Meanings {
+		fs = append(fs, m.Text, m.Example)
+	}
+	fs = append(fs, w.Etymology)
+	fs = append(fs, w.Notes...)
+	return fs
+}
+
+// textTerms splits text into terms. Terms are runs of letters and digits,
+// which are lowercased, folded into their base characters, and stemmed. If
+// stems is not nil, it is used to cache stemmed words.
+func textTerms(s string, stems map[string]string) []string {
+	var terms []string
+	for len(s) != 0 {
+		i := strings.IndexFunc(s, isTextChar)
+		if i == -1 {
+			break
+		}
+		s = s[i:]
+		j := strings.IndexFunc(s, func(r rune) bool {
+			return !isTextChar(r)
+		})
+		if j == -1 {
+			j = len(s)
+		}
+		terms = append(terms, textTerm(s[:j], stems))
+		s = s[j:]
+	}
+	return terms
+}
+
+func isTextChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// textTerm normalizes a single word.
+func textTerm(word string, stems map[string]string) string {
+	if t, ok := stems[word]; ok {
+		return t
+	}
+	t := strings.ToLower(word)
+	for i := 0; i < len(t); i++ {
+		if t[i] >= utf8.RuneSelf {
+			if f, err := normFold(t); err == nil {
+				t = f
+			}
+			break
+		}
+	}
+	if st, err := snowball.Stem(t, "english", true); err == nil {
+		t = st
+	}
+	if stems != nil {
+		stems[word] = t
+	}
+	return t
+}
@@ -0,0 +1,201 @@
+package dictionary
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// VerifyOptions configures VerifyWith.
+type VerifyOptions struct {
+	// Workers is the number of records to check in parallel. If it is zero,
+	// GOMAXPROCS is used.
+	Workers int
+	// Progress, if not nil, is called after each record is checked with the
+	// number of records checked so far and the total number of records. It is
+	// never called concurrently.
+	Progress func(done, total int)
+	// FailFast stops at the first failure rather than collecting all of them.
+	FailFast bool
+}
+
+// VerifyFailure describes a corrupt part of a dict file.
+type VerifyFailure struct {
+	Section  string // the section, if the failure is not specific to a record
+	Headword string // the headword referencing the record, if any
+	Offset   int64  // the offset of the record or section
+	Err      error
+}
+
+func (f VerifyFailure) Error() string {
+	if f.Headword != "" {
+		return fmt.Sprintf("record %s@%d: %v", f.Headword, f.Offset, f.Err)
+	}
+	return fmt.Sprintf("section %s@%d: %v", f.Section, f.Offset, f.Err)
+}
+
+// VerifyError is returned by Verify if any corruption was found. The failures
+// are sorted by offset, then headword.
+type VerifyError struct {
+	Failures []VerifyFailure
+}
+
+func (e *VerifyError) Error() string {
+	if len(e.Failures) == 1 {
+		return fmt.Sprintf("failed: %v", e.Failures[0])
+	}
+	return fmt.Sprintf("failed: %v (and %d more)", e.Failures[0], len(e.Failures)-1)
+}
+
+// Verify is shorthand for VerifyWith with the default options.
+func (d *File) Verify() error {
+	return d.VerifyWith(VerifyOptions{})
+}
+
+// VerifyWith verifies the consistency of the data structures in the dict file.
+// It bypasses the cache. If the file has section digests, they are checked too.
+// Every record is decoded, and checked to ensure it is within the data and
+// does not overlap other records. Unless FailFast is set, every record is
+// checked, and if any are corrupt, a *VerifyError listing all of them is
+// returned. Records referenced by multiple headwords are only checked once, but
+// are reported for each headword.
+// WARNING: VerifyWith takes a few seconds to run.
+func (d *File) VerifyWith(opt VerifyOptions) error {
+	if opt.Workers <= 0 {
+		opt.Workers = runtime.GOMAXPROCS(0)
+	}
+
+	var fs []VerifyFailure
+	fail := func(f VerifyFailure) error {
+		fs = append(fs, f)
+		if opt.FailFast {
+			return &VerifyError{fs}
+		}
+		return nil
+	}
+
+	for _, sec := range d.sections {
+		if err := sec.verify(d.df); err != nil {
+			if err := fail(VerifyFailure{
+				Section: sec.Name(),
+				Offset:  sec.Offset,
+				Err:     err,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// collect the records
+	refs := map[size][]string{}
+	if err := d.idx.Each(func(word string, cur []size) error {
+		for _, o := range cur {
+			refs[o] = append(refs[o], word)
+		}
+		return nil
+	}); err != nil {
+		if err := fail(VerifyFailure{
+			Section: sectionIdx,
+			Err:     err,
+		}); err != nil {
+			return err
+		}
+	}
+	recs := make([]size, 0, len(refs))
+	for o := range refs {
+		recs = append(recs, o)
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i] < recs[j]
+	})
+
+	// check the records
+	ns, errs := d.verifyRecords(recs, opt)
+
+	// check for overlapping records (the bounds were checked while decoding)
+	for i, o := range recs {
+		if i != 0 && errs[i] == nil && errs[i-1] == nil && int64(recs[i-1])+ns[i-1] > int64(o) {
+			errs[i] = formatErr("record", int64(o), ErrOutOfBounds, fmt.Errorf("record %d+%d overlaps record %d+%d", o, ns[i], recs[i-1], ns[i-1]))
+		}
+	}
+
+	for i, o := range recs {
+		if errs[i] == nil {
+			continue
+		}
+		hws := refs[o]
+		sort.Strings(hws)
+		for _, hw := range hws {
+			if err := fail(VerifyFailure{
+				Headword: hw,
+				Offset:   int64(o),
+				Err:      errs[i],
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	debug.FreeOSMemory()
+
+	if len(fs) != 0 {
+		sort.SliceStable(fs, func(i, j int) bool {
+			if fs[i].Offset != fs[j].Offset {
+				return fs[i].Offset < fs[j].Offset
+			}
+			return fs[i].Headword < fs[j].Headword
+		})
+		return &VerifyError{fs}
+	}
+	return nil
+}
+
+// verifyRecords decodes the records in parallel, returning their sizes and
+// errors. If FailFast is set, it stops after the first error.
+func (d *File) verifyRecords(recs []size, opt VerifyOptions) ([]int64, []error) {
+	ns := make([]int64, len(recs))
+	errs := make([]error, len(recs))
+
+	var next int64 = -1
+	var stop int32
+	var mu sync.Mutex
+	var done int
+	var wg sync.WaitGroup
+	for n := 0; n < opt.Workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(recs) || atomic.LoadInt32(&stop) != 0 {
+					return
+				}
+
+				var err error
+				if ns[i], err = d.recordSize(recs[i]); err != nil {
+					errs[i] = err
+				} else if w, err := d.read(recs[i]); err != nil {
+					errs[i] = err
+				} else if w.Word == "" {
+					errs[i] = fmt.Errorf("empty word")
+				}
+				if errs[i] != nil && opt.FailFast {
+					atomic.StoreInt32(&stop, 1)
+				}
+
+				if opt.Progress != nil {
+					mu.Lock()
+					done++
+					opt.Progress(done, len(recs))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return ns, errs
+}
@@ -0,0 +1,105 @@
+package dictionary
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyWith(t *testing.T) {
+	buf := testWriterFile(t)
+
+	d, err := OpenBytes(buf)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := d.VerifyWith(VerifyOptions{Workers: 4}); err != nil {
+		t.Errorf("verify uncorrupted: %v", err)
+	}
+	lead, _, _ := d.idx.Get("lead") // the noun, then the verb (which is also led)
+	zebra, _, _ := d.idx.Get("zebra")
+	data, _ := d.section(sectionData)
+	d.Close()
+
+	b := append([]byte{}, buf...)
+
+	// extend the first lead record over the size of the next one, with a
+	// valid checksum (the extra data is ignored when decoding it)
+	a, next := int64(lead[0]), int64(lead[1])
+	if n := int64(binary.LittleEndian.Uint64(b[a:])); a+n != next {
+		t.Fatalf("expected lead records to be consecutive")
+	}
+	binary.LittleEndian.PutUint64(b[a:], uint64(next+sizew-a))
+	binary.LittleEndian.PutUint32(b[a+sizew:], crc32.Checksum(b[a+sizew+crcw:next+sizew], crcTable))
+
+	// corrupt the data of the zebra record
+	b[int64(zebra[0])+sizew+crcw+2] ^= 0xFF
+
+	if d, err = OpenBytes(b); err != nil {
+		t.Fatalf("open corrupted: %v", err)
+	}
+	defer d.Close()
+
+	var fss [][]string
+	for _, workers := range []int{1, 8} {
+		var calls, done, total int
+		err := d.VerifyWith(VerifyOptions{
+			Workers: workers,
+			Progress: func(d, t int) {
+				calls, done, total = calls+1, d, t
+			},
+		})
+		if calls != 5 || done != 5 || total != 5 {
+			t.Errorf("workers %d: expected progress to be called 5 times and end at 5/5, got %d times and %d/%d", workers, calls, done, total)
+		}
+
+		var ve *VerifyError
+		if !errors.As(err, &ve) {
+			t.Fatalf("workers %d: expected VerifyError, got %v", workers, err)
+		}
+		for i, c := range []struct {
+			section  string
+			headword string
+			offset   int64
+			kind     error // or nil for a section digest
+		}{
+			{sectionData, "", data.Offset, nil},
+			{"", "lead", next, ErrOutOfBounds}, // overlaps the previous one
+			{"", "led", next, ErrOutOfBounds},
+			{"", "zebra", int64(zebra[0]), ErrChecksum},
+		} {
+			if i >= len(ve.Failures) {
+				t.Errorf("workers %d: missing failure %d (%s%s@%d)", workers, i, c.section, c.headword, c.offset)
+				continue
+			}
+			f := ve.Failures[i]
+			if f.Section != c.section || f.Headword != c.headword || f.Offset != c.offset {
+				t.Errorf("workers %d: failure %d: expected %s%s@%d, got %s%s@%d", workers, i, c.section, c.headword, c.offset, f.Section, f.Headword, f.Offset)
+			} else if c.kind == nil && !strings.Contains(f.Err.Error(), "digest mismatch") {
+				t.Errorf("workers %d: failure %d: expected digest mismatch, got %v", workers, i, f.Err)
+			} else if c.kind != nil && !errors.Is(f.Err, c.kind) {
+				t.Errorf("workers %d: failure %d: expected %v, got %v", workers, i, c.kind, f.Err)
+			}
+		}
+		if len(ve.Failures) != 4 {
+			t.Errorf("workers %d: expected 4 failures, got %d: %v", workers, len(ve.Failures), ve.Failures)
+		}
+
+		var fs []string
+		for _, f := range ve.Failures {
+			fs = append(fs, f.Error())
+		}
+		fss = append(fss, fs)
+	}
+	if !reflect.DeepEqual(fss[0], fss[1]) {
+		t.Errorf("expected the same failures with multiple workers:\n%q\n%q", fss[0], fss[1])
+	}
+
+	var ve *VerifyError
+	if err := d.VerifyWith(VerifyOptions{FailFast: true}); !errors.As(err, &ve) || len(ve.Failures) != 1 {
+		t.Errorf("expected one failure with FailFast, got %v", err)
+	}
+}
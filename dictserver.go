@@ -2,9 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -18,37 +24,131 @@ type ctxKey string
 
 func main() {
 	addr := pflag.StringP("addr", "a", ":8000", "Address to listen on")
+	mmap := pflag.Bool("mmap", false, "Memory-map the dict file (only supported on Linux)")
+	cache := pflag.Int("cache", 0, "Number of decoded entries to cache in memory (0 to disable)")
+	overlay := pflag.String("overlay", "", "Apply local changes from an overlay file (see tools/dictoverlay), which is reloaded on SIGHUP")
+	dedupe := pflag.String("dedupe", "exact", "How to dedupe entries from multiple dict files (none, exact, info)")
+	normalize := pflag.String("normalize", "default", "Normalization steps for looking up words, optionally prefixed by prepare: or try: (e.g. trim-space,lowercase,try:stem)")
 	help := pflag.BoolP("help", "h", false, "Show this message")
 	pflag.Parse()
 
-	var dictfile string
-	if n := pflag.NArg(); *help || n != 1 {
-		fmt.Printf("Usage: dictserver [options] DICT_FILE\n   or: dictserver [options] DB_BASE\n\nVersion: dictserver %s\n\nOptions:\n", version)
+	dedupeFn, ok := map[string]dictionary.DedupeFunc{
+		"none":  dictionary.DedupeNone,
+		"exact": dictionary.DedupeExact,
+		"info":  dictionary.DedupeInfo,
+	}[*dedupe]
+	if !ok && !*help {
+		fmt.Printf("Error: invalid --dedupe value %q (expected none|exact|info)\n\n", *dedupe)
+	}
+
+	pipeline, err := dictionary.ParsePipeline(*normalize)
+	if err != nil && !*help {
+		fmt.Printf("Error: invalid --normalize: %v\n\n", err)
+	}
+
+	var dictfiles []string
+	if n := pflag.NArg(); *help || n < 1 || !ok || err != nil {
+		fmt.Printf("Usage: dictserver [options] DICT_FILE...\n\nVersion: dictserver %s\n\nOptions:\n", version)
 		pflag.PrintDefaults()
-		fmt.Printf("\nArguments:\n  DICT_FILE is the path to the dict file. It can be generated using tools/dictparse.\n")
+		fmt.Printf("\nArguments:\n  DICT_FILE is the path to the dict file. It can be generated using tools/dictparse.\n  It can also be a http(s) URL, in which case it is read on demand using range requests.\n  If multiple are specified, entries are returned from all of them in order of priority.\n")
 		os.Exit(1)
 	} else {
-		dictfile = pflag.Arg(0)
+		dictfiles = pflag.Args()
+	}
+
+	open := dictionary.OpenFile
+	if *mmap {
+		open = dictionary.OpenFileMmap
+	}
+
+	var stores []dictionary.Store
+	for _, dictfile := range dictfiles {
+		fmt.Printf("Opening dictionary '%s'\n", dictfile)
+		var d *dictionary.File
+		var err error
+		if strings.HasPrefix(dictfile, "http://") || strings.HasPrefix(dictfile, "https://") {
+			d, err = dictionary.OpenURL(dictfile, dictionary.HTTPOptions{})
+		} else {
+			d, err = open(dictfile)
+		}
+		if err != nil {
+			fmt.Printf("Error opening dictionary: %v\n", err)
+			os.Exit(1)
+		}
+		defer d.Close()
+		d.SetCacheSize(*cache)
+		fmt.Printf("-- Loaded %d entries\n", d.NumWords())
+		stores = append(stores, d)
+	}
+
+	var dict dictionary.Store
+	if len(stores) == 1 {
+		dict = stores[0]
+	} else {
+		dict = dictionary.NewMultiStore(dedupeFn, stores...)
+	}
+
+	var ov *dictionary.Overlay
+	if *overlay != "" {
+		fmt.Printf("Opening overlay '%s'\n", *overlay)
+		var err error
+		if ov, err = dictionary.OpenOverlay(*overlay); err != nil {
+			fmt.Printf("Error opening overlay: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("-- Loaded %d changes\n", len(ov.Headwords()))
+		dict = dictionary.NewOverlayStore(dict, ov)
 	}
 
-	fmt.Printf("Opening dictionary '%s'\n", dictfile)
-	dict, err := dictionary.OpenFile(dictfile)
+	fmt.Printf("Building completion index\n")
+	comp, err := dictionary.NewCompleter(dict)
 	if err != nil {
-		fmt.Printf("Error opening dictionary: %v\n", err)
+		fmt.Printf("Error building completion index: %v\n", err)
 		os.Exit(1)
 	}
-	defer dict.Close()
-	fmt.Printf("-- Loaded %d entries\n", dict.NumWords())
 
-	fmt.Printf("Listening on http://%s\n", *addr)
-	err = http.ListenAndServe(*addr, router(dict))
+	fmt.Printf("Building suggestion index\n")
+	sug, err := dictionary.NewSuggestIndex(dict)
 	if err != nil {
+		fmt.Printf("Error building suggestion index: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Building anagram index\n")
+	ana, err := dictionary.NewAnagramIndex(dict)
+	if err != nil {
+		fmt.Printf("Error building anagram index: %v\n", err)
+		os.Exit(1)
+	}
+
+	if ov != nil {
+		go func() {
+			ch := make(chan os.Signal, 1)
+			signal.Notify(ch, syscall.SIGHUP)
+			for range ch {
+				if err := ov.Reload(); err != nil {
+					fmt.Printf("Error reloading overlay: %v\n", err)
+				} else if err := comp.Reload(); err != nil {
+					fmt.Printf("Error rebuilding completion index: %v\n", err)
+				} else if err := sug.Reload(); err != nil {
+					fmt.Printf("Error rebuilding suggestion index: %v\n", err)
+				} else if err := ana.Reload(); err != nil {
+					fmt.Printf("Error rebuilding anagram index: %v\n", err)
+				} else {
+					fmt.Printf("Reloaded overlay (%d changes)\n", len(ov.Headwords()))
+				}
+			}
+		}()
+	}
+
+	fmt.Printf("Listening on http://%s\n", *addr)
+	if err := http.ListenAndServe(*addr, router(dict, pipeline, comp, sug, ana)); err != nil {
 		fmt.Printf("Error starting server: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func router(dict dictionary.Store) chi.Router {
+func router(dict dictionary.Store, pipeline dictionary.Pipeline, comp *dictionary.Completer, sug dictionary.Suggester, ana *dictionary.AnagramIndex) chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
@@ -59,10 +159,19 @@ func router(dict dictionary.Store) chi.Router {
 	r.Use(middleware.SetHeader("Access-Control-Allow-Origin", "*"))
 	r.Use(middleware.SetHeader("Server", "dictserver ("+version+")"))
 	r.Use(middleware.WithValue(ctxKey("dict"), dict))
+	r.Use(middleware.WithValue(ctxKey("pipeline"), pipeline))
+	r.Use(middleware.WithValue(ctxKey("complete"), comp))
+	r.Use(middleware.WithValue(ctxKey("suggest"), sug))
+	r.Use(middleware.WithValue(ctxKey("anagram"), ana))
 
 	r.NotFound(handleNotFound)
 	r.Get("/", handleAPI)
 	r.Get("/word/{word}", handleWord)
+	r.Get("/complete", handleComplete)
+	r.Get("/pattern", handlePattern)
+	r.Get("/anagram", handleAnagram)
+	r.Get("/search", handleSearch)
+	r.Get("/reverse", handleReverse)
 
 	return r
 }
@@ -75,18 +184,61 @@ func handleNotFound(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleAPI(w http.ResponseWriter, r *http.Request) {
+	dict := r.Context().Value(ctxKey("dict")).(dictionary.Store)
 	base := "http://" + r.Host
+	obj := map[string]interface{}{
+		"word_url":     base + "/word/{word}",
+		"complete_url": base + "/complete?prefix={prefix}&limit={limit}",
+		"pattern_url":  base + "/pattern?q={pattern}&len={length}&pos={pos}&limit={limit}",
+		"anagram_url":  base + "/anagram?letters={letters}&subset={subset}&limit={limit}",
+		"search_url":   base + "/search?q={query}&limit={limit}",
+		"reverse_url":  base + "/reverse?q={description}&limit={limit}",
+	}
+	if ovs, ok := dict.(*dictionary.OverlayStore); ok {
+		dict = ovs.Base()
+	}
+	if ms, ok := dict.(*dictionary.MultiStore); ok {
+		var mds []*dictionary.Metadata
+		for _, s := range ms.Stores() {
+			if mg, ok := s.(dictionary.MetadataGetter); ok {
+				mds = append(mds, mg.Metadata())
+			} else {
+				mds = append(mds, nil)
+			}
+		}
+		obj["dictionaries"] = mds
+	} else if mg, ok := dict.(dictionary.MetadataGetter); ok {
+		if m := mg.Metadata(); m != nil {
+			obj["metadata"] = m
+		}
+	}
 	resp{
 		statusSuccess,
-		map[string]string{
-			"word_url": base + "/word/{word}",
-		},
+		obj,
 	}.WriteTo(w, http.StatusOK)
 }
 
 func handleWord(w http.ResponseWriter, r *http.Request) {
 	dict := r.Context().Value(ctxKey("dict")).(dictionary.Store)
-	words, exists, err := dict.LookupWord(chi.URLParam(r, "word"))
+	pipeline := r.Context().Value(ctxKey("pipeline")).(dictionary.Pipeline)
+
+	opts := dictionary.DefaultLookupOptions
+	for _, o := range []struct {
+		name string
+		v    *bool
+	}{
+		{"exact", &opts.Exact},
+		{"fold", &opts.FoldDiacritics},
+		{"stem", &opts.Stem},
+		{"all", &opts.AllCandidates},
+	} {
+		var ok bool
+		if *o.v, ok = queryBool(w, r, o.name, *o.v); !ok {
+			return
+		}
+	}
+
+	words, res, exists, err := pipeline.LookupOptions(dict, chi.URLParam(r, "word"), opts)
 
 	switch {
 	case err != nil:
@@ -95,16 +247,26 @@ func handleWord(w http.ResponseWriter, r *http.Request) {
 			fmt.Sprintf("failed to look up word: %v", err),
 		}.WriteTo(w, http.StatusInternalServerError)
 	case !exists:
-		resp{
-			statusSuccess,
-			[]*dictionary.Word{},
+		sug := r.Context().Value(ctxKey("suggest")).(dictionary.Suggester)
+		suggestions, err := sug.Suggest(chi.URLParam(r, "word"), 5)
+		if err != nil {
+			suggestions = nil
+		}
+		wordResp{
+			resp{
+				statusSuccess,
+				[]*dictionary.Word{},
+			},
+			suggestions,
 		}.WriteTo(w, http.StatusNotFound)
 	default:
 		var obj struct {
 			*dictionary.Word
-			AdditionalWords []*dictionary.Word `json:"additional_words"` // words with the same headword (embedded rather than returning an array for backwards compatibility)
-			ReferencedWords []*dictionary.Word `json:"referenced_words"` // referenced words (for the entire word, not just meanings)
+			AdditionalWords []*dictionary.Word       `json:"additional_words"` // words with the same headword (embedded rather than returning an array for backwards compatibility)
+			ReferencedWords []*dictionary.Word       `json:"referenced_words"` // referenced words (for the entire word, not just meanings)
+			Lookup          *dictionary.LookupResult `json:"lookup"`           // how the word was found (including the lemma if it was an inflected form)
 		}
+		obj.Lookup = res
 
 		for i, w := range words {
 			if i == 0 {
@@ -129,6 +291,228 @@ func handleWord(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func handleComplete(w http.ResponseWriter, r *http.Request) {
+	comp := r.Context().Value(ctxKey("complete")).(*dictionary.Completer)
+
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	resp{
+		statusSuccess,
+		comp.Complete(r.URL.Query().Get("prefix"), limit),
+	}.WriteTo(w, http.StatusOK)
+}
+
+func handlePattern(w http.ResponseWriter, r *http.Request) {
+	comp := r.Context().Value(ctxKey("complete")).(*dictionary.Completer)
+
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	var length int
+	if v := r.URL.Query().Get("len"); v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 {
+			resp{
+				statusError,
+				"invalid len (must be a positive integer)",
+			}.WriteTo(w, http.StatusBadRequest)
+			return
+		} else {
+			length = n
+		}
+	}
+
+	p, err := dictionary.ParsePattern(r.URL.Query().Get("q"))
+	if err != nil {
+		resp{
+			statusError,
+			err.Error(),
+		}.WriteTo(w, http.StatusBadRequest)
+		return
+	}
+
+	// the entries need to be decoded to check the part of speech, so only a
+	// limited number of them are checked
+	var filter func(string) bool
+	var checked int
+	var filterErr error
+	if pos := r.URL.Query().Get("pos"); pos != "" {
+		dict := r.Context().Value(ctxKey("dict")).(dictionary.Store)
+		filter = func(headword string) bool {
+			if checked++; filterErr != nil || checked > maxPatternPOSChecks {
+				return false
+			}
+			ws, _, err := dict.GetWords(headword)
+			if err != nil {
+				filterErr = fmt.Errorf("get %q: %w", headword, err)
+				return false
+			}
+			for _, w := range ws {
+				if w.HasPOS(pos) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	res := comp.Match(p, length, limit, filter)
+	switch {
+	case filterErr != nil:
+		resp{
+			statusError,
+			fmt.Sprintf("failed to check part of speech: %v", filterErr),
+		}.WriteTo(w, http.StatusInternalServerError)
+	case checked > maxPatternPOSChecks:
+		resp{
+			statusError,
+			fmt.Sprintf("too many matches to filter by part of speech (more than %d), use a more specific pattern", maxPatternPOSChecks),
+		}.WriteTo(w, http.StatusBadRequest)
+	default:
+		resp{
+			statusSuccess,
+			res,
+		}.WriteTo(w, http.StatusOK)
+	}
+}
+
+// maxPatternPOSChecks is the maximum number of headwords matching a pattern to
+// check the part of speech of.
+const maxPatternPOSChecks = 1000
+
+func handleAnagram(w http.ResponseWriter, r *http.Request) {
+	ana := r.Context().Value(ctxKey("anagram")).(*dictionary.AnagramIndex)
+
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	subset, ok := queryBool(w, r, "subset", false)
+	if !ok {
+		return
+	}
+
+	letters := r.URL.Query().Get("letters")
+	if utf8.RuneCountInString(letters) > maxAnagramLetters {
+		resp{
+			statusError,
+			fmt.Sprintf("too many letters (more than %d)", maxAnagramLetters),
+		}.WriteTo(w, http.StatusBadRequest)
+		return
+	}
+
+	resp{
+		statusSuccess,
+		ana.Anagrams(letters, subset, limit),
+	}.WriteTo(w, http.StatusOK)
+}
+
+// maxAnagramLetters is the maximum number of letters to find anagrams of.
+const maxAnagramLetters = 32
+
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	dict := r.Context().Value(ctxKey("dict")).(dictionary.Store)
+
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := dictionary.Search(dict, r.URL.Query().Get("q"), limit)
+	switch {
+	case errors.Is(err, dictionary.ErrNoTextIndex):
+		resp{
+			statusError,
+			"search is not supported by this dictionary",
+		}.WriteTo(w, http.StatusNotImplemented)
+	case err != nil:
+		resp{
+			statusError,
+			fmt.Sprintf("failed to search: %v", err),
+		}.WriteTo(w, http.StatusInternalServerError)
+	default:
+		resp{
+			statusSuccess,
+			res,
+		}.WriteTo(w, http.StatusOK)
+	}
+}
+
+func handleReverse(w http.ResponseWriter, r *http.Request) {
+	dict := r.Context().Value(ctxKey("dict")).(dictionary.Store)
+
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	// dictionary.Reverse isn't used since it reads every entry if there isn't
+	// a text index
+	var res []dictionary.ReverseResult
+	err := dictionary.ErrNoTextIndex
+	if rv, ok := dict.(dictionary.Reverser); ok {
+		res, err = rv.Reverse(r.URL.Query().Get("q"), limit)
+	}
+	switch {
+	case errors.Is(err, dictionary.ErrNoTextIndex):
+		resp{
+			statusError,
+			"reverse lookups are not supported by this dictionary",
+		}.WriteTo(w, http.StatusNotImplemented)
+	case err != nil:
+		resp{
+			statusError,
+			fmt.Sprintf("failed to search: %v", err),
+		}.WriteTo(w, http.StatusInternalServerError)
+	default:
+		resp{
+			statusSuccess,
+			res,
+		}.WriteTo(w, http.StatusOK)
+	}
+}
+
+// queryLimit parses the limit query parameter (default 10), writing an error
+// and returning false if it is invalid.
+func queryLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return 10, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > 100 {
+		resp{
+			statusError,
+			"invalid limit (must be between 1 and 100)",
+		}.WriteTo(w, http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// queryBool parses a boolean query parameter, writing an error and returning
+// false if it is invalid.
+func queryBool(w http.ResponseWriter, r *http.Request, name string, def bool) (bool, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		resp{
+			statusError,
+			"invalid " + name + " (must be true or false)",
+		}.WriteTo(w, http.StatusBadRequest)
+		return false, false
+	}
+	return b, true
+}
+
 type status string
 
 const (
@@ -142,6 +526,20 @@ type resp struct {
 }
 
 func (r resp) WriteTo(w http.ResponseWriter, status int) {
+	writeJSON(w, status, r)
+}
+
+// wordResp is a resp which also has suggestions if a word was not found.
+type wordResp struct {
+	resp
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func (r wordResp) WriteTo(w http.ResponseWriter, status int) {
+	writeJSON(w, status, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
 
@@ -149,7 +547,7 @@ func (r resp) WriteTo(w http.ResponseWriter, status int) {
 	enc.SetEscapeHTML(false)
 	enc.SetIndent("", "")
 
-	err := enc.Encode(r)
+	err := enc.Encode(v)
 	if err != nil {
 		panic(err)
 	}
@@ -17,12 +17,18 @@ func main() {
 		dictfile = os.Args[1]
 		word = os.Args[2]
 	default:
-		fmt.Printf("Usage: %s DICT_FILE WORD\n", os.Args[0])
+		fmt.Printf("Usage: %s DICT_FILE|DICT_URL WORD\n", os.Args[0])
 		os.Exit(1)
 	}
 
 	fmt.Printf("Opening dictionary\n")
-	dict, err := dictionary.OpenFile(dictfile)
+	var dict *dictionary.File
+	var err error
+	if strings.HasPrefix(dictfile, "http://") || strings.HasPrefix(dictfile, "https://") {
+		dict, err = dictionary.OpenURL(dictfile, dictionary.HTTPOptions{})
+	} else {
+		dict, err = dictionary.OpenFile(dictfile)
+	}
 	if err != nil {
 		fmt.Printf("Error opening dictionary: %v\n", err)
 		os.Exit(1)
@@ -30,13 +36,21 @@ func main() {
 	defer dict.Close()
 
 	fmt.Printf("Looking up word\n")
-	ws, exists, err := dict.LookupWord(word)
+	ws, res, exists, err := dictionary.LookupWordResult(dict, word)
 	if err != nil {
 		fmt.Printf("Error looking up word: %v\n", err)
 		os.Exit(1)
 	} else if !exists {
 		fmt.Printf("\n%s: word not in dictionary\n", strings.ToUpper(word))
+		if ss, err := dictionary.Suggest(dict, word, 5); err == nil && len(ss) != 0 {
+			fmt.Printf("Did you mean: %s?\n", strings.Join(ss, ", "))
+		}
 	} else {
+		if res.Lemma != nil {
+			fmt.Printf("\n%s: %s of %s\n", strings.ToUpper(res.Lemma.Inflection), strings.Join(res.Lemma.Tags, " and "), strings.ToUpper(res.Lemma.Headword))
+		} else if res.Key != word {
+			fmt.Printf("\nShowing results for %s (%s)\n", strings.ToUpper(res.Key), strings.Join(res.Steps, ", "))
+		}
 		for _, w := range ws {
 			fmt.Printf("\n%s:\n", strings.ToUpper(strings.Join(append([]string{w.Word}, w.Alternates...), ", ")))
 			fmt.Println(w.Info)
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pgaskin/dictserver/dictionary"
+)
+
+var version = "dev"
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+	}
+	ovfile, cmd, args := os.Args[1], os.Args[2], os.Args[3:]
+
+	ov, err := dictionary.OpenOverlay(ovfile)
+	if err != nil {
+		fmt.Printf("Error opening overlay: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case cmd == "list" && len(args) == 0:
+		for _, hw := range ov.Headwords() {
+			e, _ := ov.Get(hw)
+			fmt.Printf("%s\t%s\t%d\n", hw, e.Action, len(e.Words))
+		}
+	case cmd == "show" && len(args) == 1:
+		e, ok := ov.Get(args[0])
+		if !ok {
+			fmt.Printf("%s: not in overlay\n", strings.ToUpper(args[0]))
+			os.Exit(1)
+		}
+		buf, err := json.MarshalIndent(e, "", "    ")
+		if err != nil {
+			fmt.Printf("Error encoding entry: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(buf))
+	case (cmd == "add" || cmd == "replace") && len(args) == 2:
+		ws, err := readWords(args[1])
+		if err != nil {
+			fmt.Printf("Error reading entries: %v\n", err)
+			os.Exit(1)
+		}
+		if cmd == "add" {
+			err = ov.Add(args[0], ws...)
+		} else {
+			err = ov.Replace(args[0], ws...)
+		}
+		if err != nil {
+			fmt.Printf("Error updating overlay: %v\n", err)
+			os.Exit(1)
+		}
+	case cmd == "hide" && len(args) == 1:
+		if err := ov.Hide(args[0]); err != nil {
+			fmt.Printf("Error updating overlay: %v\n", err)
+			os.Exit(1)
+		}
+	case cmd == "reset" && len(args) == 1:
+		if err := ov.Reset(args[0]); err != nil {
+			fmt.Printf("Error updating overlay: %v\n", err)
+			os.Exit(1)
+		}
+	case cmd == "lookup" && len(args) == 2:
+		dict, err := dictionary.OpenFile(args[0])
+		if err != nil {
+			fmt.Printf("Error opening dictionary: %v\n", err)
+			os.Exit(1)
+		}
+		defer dict.Close()
+
+		ws, exists, err := dictionary.NewOverlayStore(dict, ov).LookupWord(args[1])
+		if err != nil {
+			fmt.Printf("Error looking up word: %v\n", err)
+			os.Exit(1)
+		} else if !exists {
+			fmt.Printf("%s: word not in dictionary\n", strings.ToUpper(args[1]))
+			os.Exit(1)
+		}
+		buf, err := json.MarshalIndent(ws, "", "    ")
+		if err != nil {
+			fmt.Printf("Error encoding entries: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(buf))
+	default:
+		usage()
+	}
+}
+
+// readWords reads a JSON Word or array of Words from a file, or stdin if it is
+// "-".
+func readWords(fn string) ([]*dictionary.Word, error) {
+	var r io.Reader = os.Stdin
+	if fn != "-" {
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ws []*dictionary.Word
+	if err := json.Unmarshal(buf, &ws); err != nil {
+		var w dictionary.Word
+		if err := json.Unmarshal(buf, &w); err != nil {
+			return nil, err
+		}
+		ws = []*dictionary.Word{&w}
+	}
+	for _, w := range ws {
+		if w == nil || w.Word == "" {
+			return nil, fmt.Errorf("entry is missing word")
+		}
+	}
+	return ws, nil
+}
+
+func usage() {
+	fmt.Printf("Usage: %s OVERLAY_FILE COMMAND [ARGS...]\n\nVersion: dictoverlay %s\n\nCommands:\n", os.Args[0], version)
+	fmt.Printf("  list                         List the headwords changed by the overlay\n")
+	fmt.Printf("  show HEADWORD                Show the change for a headword as JSON\n")
+	fmt.Printf("  add HEADWORD JSON_FILE       Add entries (a JSON word or array of words, or - for stdin) to a headword\n")
+	fmt.Printf("  replace HEADWORD JSON_FILE   Replace the entries for a headword\n")
+	fmt.Printf("  hide HEADWORD                Hide a headword\n")
+	fmt.Printf("  reset HEADWORD               Remove the change for a headword\n")
+	fmt.Printf("  lookup DICT_FILE WORD        Look up a word with the overlay applied\n")
+	fmt.Printf("\nThe overlay file is created if it does not exist. It can be used with dictserver --overlay.\n")
+	fmt.Printf("Headwords are lowercased and trimmed to match the ones in the dictionary.\n")
+	os.Exit(1)
+}
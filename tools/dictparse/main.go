@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/pgaskin/dictserver/dictionary"
 )
@@ -10,16 +12,52 @@ import (
 var version = "dev"
 
 func main() {
-	var txt, dictfile string
+	var txt, dictfile, about string
 	switch len(os.Args) {
 	case 3:
 		txt = os.Args[1]
 		dictfile = os.Args[2]
+		about = txt
+	case 4:
+		txt = os.Args[1]
+		dictfile = os.Args[2]
+		about = os.Args[3]
 	default:
-		fmt.Printf("Usage: %s DICT_TXT_IN DICT_FILE_OUT\n", os.Args[0])
+		fmt.Printf("Usage: %s DICT_TXT_IN DICT_FILE_OUT [ABOUT_TXT_IN]\n", os.Args[0])
 		os.Exit(1)
 	}
 
+	fmt.Printf("Reading metadata\n")
+	meta, err := func() (*dictionary.Metadata, error) {
+		f, err := os.OpenFile(about, os.O_RDONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return dictionary.ParseMetadata(f)
+	}()
+	if err != nil {
+		fmt.Printf("Warning: could not read metadata from '%s': %v\n", about, err)
+		meta = &dictionary.Metadata{}
+	} else if meta.Title == "" {
+		fmt.Printf("Warning: could not find a title in the metadata from '%s'\n", about)
+	}
+	meta.BuilderVersion = "dictparse " + version
+
+	// the build time is only set if specified, so the output is reproducible
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+		if sde, err := strconv.ParseInt(v, 10, 64); err != nil {
+			fmt.Printf("Invalid SOURCE_DATE_EPOCH '%s': %v\n", v, err)
+			os.Exit(1)
+		} else {
+			meta.BuildTime = time.Unix(sde, 0).UTC()
+		}
+	}
+
+	if meta.Title != "" {
+		fmt.Printf("-- %s (%s)\n", meta.Title, meta.Language)
+	}
+
 	fmt.Printf("Opening input file\n")
 	f, err := os.OpenFile(txt, os.O_RDONLY, 0)
 	if err != nil {
@@ -38,7 +76,21 @@ func main() {
 	fmt.Printf("-- Parsed %d entries\n", wm.NumWords())
 
 	fmt.Printf("Creating database\n")
-	err = dictionary.CreateFile(wm, dictfile)
+	err = func() error {
+		dw, err := dictionary.CreateWriter(dictfile)
+		if err != nil {
+			return err
+		}
+		defer dw.Close()
+		if err := dw.EnableTextIndex(); err != nil {
+			return err
+		}
+		dw.SetMetadata(meta)
+		if err := dw.AddWordMap(wm); err != nil {
+			return err
+		}
+		return dw.Close()
+	}()
 	if err != nil {
 		fmt.Printf("Could not export dictionary file to '%s': %v\n", dictfile, err)
 		os.Exit(1)
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/pgaskin/dictserver/dictionary"
 )
@@ -27,12 +28,75 @@ func main() {
 	}
 	defer dict.Close()
 
+	if m := dict.Metadata(); m != nil {
+		if m.Title != "" {
+			fmt.Printf("-- Title: %s\n", m.Title)
+		}
+		if m.Description != "" {
+			fmt.Printf("-- Description: %s\n", m.Description)
+		}
+		if m.Language != "" {
+			fmt.Printf("-- Language: %s\n", m.Language)
+		}
+		if m.SourceURL != "" {
+			fmt.Printf("-- Source: %s\n", m.SourceURL)
+		}
+		if !m.BuildTime.IsZero() {
+			fmt.Printf("-- Built: %s\n", m.BuildTime.Format(time.RFC3339))
+		}
+		if m.BuilderVersion != "" {
+			fmt.Printf("-- Builder: %s\n", m.BuilderVersion)
+		}
+		fmt.Printf("-- Headwords: %d\n", m.Headwords)
+		fmt.Printf("-- Entries: %d\n", m.Entries)
+	} else {
+		fmt.Printf("-- No metadata\n")
+	}
+
 	fmt.Printf("Verifying\n")
-	err = dict.Verify()
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+	var records int
+	var last time.Time
+	start := time.Now()
+	err = dict.VerifyWith(dictionary.VerifyOptions{
+		Progress: func(done, total int) {
+			records = total
+			if now := time.Now(); done == total || now.Sub(last) > time.Second/4 {
+				fmt.Printf("\r-- Checked %d/%d records (%.0f%%)", done, total, float64(done)/float64(total)*100)
+				last = now
+			}
+		},
+	})
+	if records != 0 {
+		fmt.Printf("\n")
+	}
+
+	fmt.Printf("\nSummary:\n")
+	fmt.Printf("  Headwords: %d\n", dict.NumWords())
+	fmt.Printf("  Records:   %d\n", records)
+	fmt.Printf("  Time:      %s\n", time.Since(start).Round(time.Millisecond))
+
+	if verr, ok := err.(*dictionary.VerifyError); ok {
+		var sections, recs int
+		bad := map[int64]bool{}
+		for _, f := range verr.Failures {
+			if f.Headword == "" {
+				sections++
+			} else if !bad[f.Offset] {
+				bad[f.Offset] = true
+				recs++
+			}
+		}
+		fmt.Printf("  Corrupt:   %d sections, %d records\n", sections, recs)
+		fmt.Printf("\nFailures:\n")
+		for _, f := range verr.Failures {
+			fmt.Printf("  %v\n", f)
+		}
+		fmt.Printf("\nError: found %d problems\n", len(verr.Failures))
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Printf("\nError: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Done\n")
+	fmt.Printf("\nDone\n")
 }